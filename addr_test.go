@@ -0,0 +1,97 @@
+package aznet
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+// azuriteKey is the well-known Azurite account key; creating clients with it
+// makes no request.
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+func TestTransportAddrs(t *testing.T) {
+	const connID = "0b7e5bd2-3c8d-4c6e-9d62-4b8f3a1f7d10"
+	const sid = "0b7e5bd23c8d4c6e9d624b8f3a1f7d10"
+	u, _ := url.Parse("http://127.0.0.1:10000/devstoreaccount1")
+	ep := &Endpoint{URL: u, Account: "devstoreaccount1", Key: azuriteKey}
+	cfg := defaultConfig()
+	tokens := SessionTokens{Req: "sig=req", Res: "sig=res"}
+
+	newQueue := func(t *testing.T) Driver {
+		client, err := newQueueClient(ep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &queueDriver{ep: ep, cfg: cfg, client: client}
+	}
+	newTable := func(t *testing.T) Driver {
+		client, err := newTableClient(ep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &tableDriver{ep: ep, cfg: cfg, client: client}
+	}
+	newBlob := func(*testing.T) Driver { return &blobDriver{ep: ep, cfg: cfg} }
+	newBlobService := func(*testing.T) Driver {
+		c := defaultConfig()
+		c.service = "api"
+		return &blobDriver{ep: ep, cfg: c}
+	}
+
+	// LocalAddr is what the side reads from, RemoteAddr what it writes to.
+	// The blob listener creates its blobs in NewTransport, so only the dialer
+	// is checked here.
+	tests := []struct {
+		name        string
+		driver      func(*testing.T) Driver
+		isInitiator bool
+		local       string
+		remote      string
+	}{
+		{"azblob dialer", newBlob, true, connID + "/res-0", connID + "/req-0"},
+		{"azblob dialer with service", newBlobService, true, "api-" + connID + "/res-0", "api-" + connID + "/req-0"},
+		{"azqueue dialer", newQueue, true, "res-" + connID, "req-" + connID},
+		{"azqueue listener", newQueue, false, "req-" + connID, "res-" + connID},
+		{"aztable dialer", newTable, true, "res" + sid, "req" + sid},
+		{"aztable listener", newTable, false, "req" + sid, "res" + sid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := tt.driver(t).NewTransport(context.Background(), connID, tokens, tt.isInitiator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tr.LocalAddr().(ServiceAddr).Resource; got != tt.local {
+				t.Errorf("LocalAddr() resource = %q, want %q", got, tt.local)
+			}
+			if got := tr.RemoteAddr().(ServiceAddr).Resource; got != tt.remote {
+				t.Errorf("RemoteAddr() resource = %q, want %q", got, tt.remote)
+			}
+		})
+	}
+}
+
+func TestBlobTransportAddrFollowsRotation(t *testing.T) {
+	const connID = "0b7e5bd2-3c8d-4c6e-9d62-4b8f3a1f7d10"
+	u, _ := url.Parse("http://127.0.0.1:10000/devstoreaccount1")
+	p := &blobDriver{ep: &Endpoint{URL: u, Account: "devstoreaccount1"}, cfg: defaultConfig()}
+	tr, err := p.NewTransport(context.Background(), connID, SessionTokens{Req: "sig=x", Res: "sig=x"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			_ = tr.LocalAddr().String()
+		}
+	}()
+	if err := tr.(Rotator).RotateRX(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if got, want := tr.LocalAddr().(ServiceAddr).Resource, connID+"/res-1"; got != want {
+		t.Errorf("LocalAddr() resource after RotateRX = %q, want %q", got, want)
+	}
+}
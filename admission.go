@@ -0,0 +1,130 @@
+package aznet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AcceptFilter inspects a handshake before the listener allocates any storage
+// for it. data is what the dialer passed to WithHandshakeData, or nil. Returning
+// a non-nil error rejects the handshake; it is then deleted so later accept
+// polls do not reconsider it.
+type AcceptFilter func(connID string, data []byte) error
+
+// acceptLimiter caps the number of handshakes accepted per fixed window. A nil
+// limiter admits everything. Safe for concurrent use.
+type acceptLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	start  time.Time
+	count  int
+}
+
+func newAcceptLimiter(limit int, window time.Duration) *acceptLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &acceptLimiter{limit: limit, window: window}
+}
+
+// allow reports whether one more handshake fits in the current window, and
+// counts it if so.
+func (r *acceptLimiter) allow() bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.start) >= r.window {
+		r.start, r.count = now, 0
+	}
+	if r.count >= r.limit {
+		return false
+	}
+	r.count++
+	return true
+}
+
+// release gives back a slot taken by allow for a handshake that was not
+// accepted after all, e.g. because another listener claimed it.
+func (r *acceptLimiter) release() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count > 0 {
+		r.count--
+	}
+}
+
+// replayCache refuses stale and replayed handshakes. A handshake is fresh if
+// its timestamp is within maxAge of now, either way to allow for clock skew.
+// Handshakes of dialers that predate timestamps carry none; they are admitted
+// unless the cache is strict. Accepted connection IDs are remembered until
+// their handshake would be stale anyway, so the cache holds at most the
+// handshakes of one validity window. A nil cache admits everything. Safe for
+// concurrent use.
+type replayCache struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	strict bool                 // refuse handshakes without a timestamp
+	seen   map[string]time.Time // connID → when its handshake goes stale
+}
+
+func newReplayCache(maxAge time.Duration, strict bool) *replayCache {
+	if maxAge <= 0 {
+		return nil
+	}
+	return &replayCache{maxAge: maxAge, strict: strict, seen: make(map[string]time.Time)}
+}
+
+// check returns ErrHandshakeStale if ts is outside the validity window, or
+// zero in a strict cache, and ErrHandshakeReplayed if connID was already
+// accepted.
+func (r *replayCache) check(connID string, ts time.Time) error {
+	if r == nil {
+		return nil
+	}
+	switch {
+	case ts.IsZero():
+		if r.strict {
+			return fmt.Errorf("%w: no timestamp", ErrHandshakeStale)
+		}
+	default:
+		if d := time.Since(ts); d > r.maxAge || d < -r.maxAge {
+			return fmt.Errorf("%w: stamped %s", ErrHandshakeStale, ts.UTC().Format(time.RFC3339))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[connID]; ok {
+		return ErrHandshakeReplayed
+	}
+	return nil
+}
+
+// add remembers an accepted connID whose handshake was stamped ts, or accepted
+// now if ts is zero, and forgets those that have gone stale.
+func (r *replayCache) add(connID string, ts time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if ts.IsZero() {
+		ts = now
+	}
+	for id, stale := range r.seen {
+		if now.After(stale) {
+			delete(r.seen, id)
+		}
+	}
+	r.seen[connID] = ts.Add(r.maxAge)
+}
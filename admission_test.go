@@ -0,0 +1,115 @@
+package aznet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcceptLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		window time.Duration
+		ops    string // a = allow, r = release
+		want   string // per allow: y = admitted, n = refused
+	}{
+		{"nil admits everything", 0, time.Hour, "aaaa", "yyyy"},
+		{"no window admits everything", 2, 0, "aaaa", "yyyy"},
+		{"limit reached", 2, time.Hour, "aaa", "yyn"},
+		{"release frees a slot", 2, time.Hour, "aaara", "yyny"},
+		{"release on empty window is a no-op", 1, time.Hour, "rraa", "yn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newAcceptLimiter(tt.limit, tt.window)
+			var got []byte
+			for _, op := range tt.ops {
+				switch op {
+				case 'a':
+					if r.allow() {
+						got = append(got, 'y')
+					} else {
+						got = append(got, 'n')
+					}
+				case 'r':
+					r.release()
+				}
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptLimiterWindowReset(t *testing.T) {
+	r := newAcceptLimiter(1, 10*time.Millisecond)
+	if !r.allow() {
+		t.Fatal("first allow refused")
+	}
+	if r.allow() {
+		t.Fatal("second allow admitted within the window")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !r.allow() {
+		t.Fatal("allow refused after the window rolled over")
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	const maxAge = time.Minute
+	now := time.Now()
+	tests := []struct {
+		name     string
+		strict   bool
+		accepted map[string]time.Time // connIDs already added, with their stamps
+		connID   string
+		ts       time.Time
+		want     error
+	}{
+		{"fresh", false, nil, "a", now, nil},
+		{"clock skew ahead", false, nil, "a", now.Add(maxAge / 2), nil},
+		{"too old", false, nil, "a", now.Add(-2 * maxAge), ErrHandshakeStale},
+		{"too far ahead", false, nil, "a", now.Add(2 * maxAge), ErrHandshakeStale},
+		{"unstamped admitted", false, nil, "a", time.Time{}, nil},
+		{"unstamped refused when strict", true, nil, "a", time.Time{}, ErrHandshakeStale},
+		{"replayed", false, map[string]time.Time{"a": now}, "a", now, ErrHandshakeReplayed},
+		{"unstamped replayed", false, map[string]time.Time{"a": time.Time{}}, "a", time.Time{}, ErrHandshakeReplayed},
+		{"other connection", false, map[string]time.Time{"a": now}, "b", now, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReplayCache(maxAge, tt.strict)
+			for id, ts := range tt.accepted {
+				r.add(id, ts)
+			}
+			if err := r.check(tt.connID, tt.ts); !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayCacheForgetsStale(t *testing.T) {
+	r := newReplayCache(time.Minute, false)
+	r.add("old", time.Now().Add(-2*time.Minute))
+	r.add("new", time.Now())
+	if _, ok := r.seen["old"]; ok {
+		t.Error("stale connID still remembered")
+	}
+	if _, ok := r.seen["new"]; !ok {
+		t.Error("fresh connID forgotten")
+	}
+}
+
+func TestReplayCacheDisabled(t *testing.T) {
+	r := newReplayCache(0, true)
+	if r != nil {
+		t.Fatal("newReplayCache(0) != nil")
+	}
+	r.add("a", time.Time{})
+	if err := r.check("a", time.Time{}); err != nil {
+		t.Errorf("nil cache check() = %v, want nil", err)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
@@ -20,8 +22,10 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/google/uuid"
 )
 
 const blobDriverName = "azblob"
@@ -72,6 +76,7 @@ func (d *blobFactory) NewDriver(ep *Endpoint, cfg *Config) (Driver, error) {
 		cfg:                cfg,
 		handshakeContainer: hc,
 		tokenContainer:     tc,
+		leaseID:            uuid.New().String(),
 	}, nil
 }
 
@@ -92,6 +97,12 @@ type blobDriver struct {
 	cfg    *Config
 
 	handshakeContainer, tokenContainer *container.Client
+
+	// leaseID identifies this listener instance when claiming handshake blobs.
+	// leased holds the names of handshake blobs it currently leases, since a
+	// delete must carry the lease ID exactly when one is held.
+	leaseID string
+	leased  sync.Map // blob name -> struct{}
 }
 
 func (p *blobDriver) PostHandshake(ctx context.Context, connID string, msg []byte) error {
@@ -115,25 +126,74 @@ func (p *blobDriver) GetHandshakes(ctx context.Context) ([]Handshake, error) {
 			return nil, err
 		}
 		for _, item := range resp.Segment.BlobItems {
-			if item.Name == nil || item.Metadata == nil {
+			if item.Name == nil {
 				continue
 			}
-			encoded, ok := item.Metadata["payload"]
-			if !ok || encoded == nil {
-				continue
+			// Blobs without a readable payload are still listed, with a nil
+			// Payload, so the listener deletes them.
+			hs := Handshake{ID: *item.Name}
+			if item.Properties != nil && item.Properties.CreationTime != nil {
+				hs.Created = *item.Properties.CreationTime
 			}
-			data, err := base64.StdEncoding.DecodeString(*encoded)
-			if err != nil {
-				continue
+			if encoded := item.Metadata["payload"]; encoded != nil {
+				hs.Payload, _ = base64.StdEncoding.DecodeString(*encoded)
 			}
-			handshakes = append(handshakes, Handshake{ID: *item.Name, Payload: data})
+			handshakes = append(handshakes, hs)
 		}
 	}
 	return handshakes, nil
 }
 
+// CancelHandshake strips the payload from the handshake blob, which the
+// bootstrap SAS's write permission allows. It fails if a listener has already
+// leased the blob, i.e. is accepting it.
+func (p *blobDriver) CancelHandshake(ctx context.Context, connID string) error {
+	_, err := p.handshakeContainer.NewBlobClient(connID).SetMetadata(ctx, nil, nil)
+	return err
+}
+
+// ClaimHandshake leases the handshake blob. The lease ID is fixed per driver, so
+// re-claiming our own handshake renews it while any other replica gets a
+// LeaseAlreadyPresent conflict.
+func (p *blobDriver) ClaimHandshake(ctx context.Context, hs Handshake) (string, error) {
+	lc, err := lease.NewBlobClient(p.handshakeContainer.NewBlobClient(hs.ID), &lease.BlobClientOptions{LeaseID: &p.leaseID})
+	if err != nil {
+		return "", err
+	}
+	if _, err := lc.AcquireLease(ctx, int32(handshakeClaimTTL/time.Second), nil); err != nil {
+		if bloberror.HasCode(err, bloberror.LeaseAlreadyPresent, bloberror.BlobNotFound) {
+			return "", ErrHandshakeClaimed
+		}
+		return "", err
+	}
+	p.leased.Store(hs.ID, struct{}{})
+	return hs.ID, nil
+}
+
+// ReleaseHandshake breaks our lease on the handshake blob and forgets it, so
+// DeleteHandshake no longer presents the lease ID.
+func (p *blobDriver) ReleaseHandshake(ctx context.Context, hs Handshake) error {
+	if _, ok := p.leased.LoadAndDelete(hs.ID); !ok {
+		return nil
+	}
+	lc, err := lease.NewBlobClient(p.handshakeContainer.NewBlobClient(hs.ID), &lease.BlobClientOptions{LeaseID: &p.leaseID})
+	if err != nil {
+		return err
+	}
+	if _, err := lc.ReleaseLease(ctx, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.LeaseIDMismatchWithLeaseOperation, bloberror.LeaseNotPresentWithLeaseOperation) {
+		return err
+	}
+	return nil
+}
+
 func (p *blobDriver) DeleteHandshake(ctx context.Context, id string) error {
-	_, err := p.handshakeContainer.NewBlobClient(id).Delete(ctx, nil)
+	var opts *blob.DeleteOptions
+	if _, ok := p.leased.LoadAndDelete(id); ok {
+		opts = &blob.DeleteOptions{AccessConditions: &blob.AccessConditions{
+			LeaseAccessConditions: &blob.LeaseAccessConditions{LeaseID: &p.leaseID},
+		}}
+	}
+	_, err := p.handshakeContainer.NewBlobClient(id).Delete(ctx, opts)
 	return err
 }
 
@@ -200,11 +260,22 @@ func (p *blobDriver) CreateBootstrapTokens() (string, string, error) {
 	return hSAS, tSAS, nil
 }
 
+// sessionContainer names the container of a session: the connID, after the
+// service name if one is set.
+func (p *blobDriver) sessionContainer(connID string) string {
+	if p.cfg.service == "" {
+		return connID
+	}
+	return p.cfg.service + "-" + connID
+}
+
 func (p *blobDriver) CreateSession(ctx context.Context, connID string) (SessionTokens, error) {
-	if _, err := p.client.CreateContainer(ctx, connID, nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+	opts := &container.CreateOptions{Metadata: activityMetadata(time.Now())}
+	name := p.sessionContainer(connID)
+	if _, err := p.client.CreateContainer(ctx, name, opts); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
 		return SessionTokens{}, fmt.Errorf("create session container: %w", err)
 	}
-	tokenSAS, err := p.makeSAS(connID, sas.ContainerPermissions{Read: true, List: true, Add: true, Create: true, Write: true})
+	tokenSAS, err := p.makeSAS(name, sas.ContainerPermissions{Read: true, List: true, Add: true, Create: true, Write: true})
 	if err != nil {
 		return SessionTokens{}, fmt.Errorf("%w: %v", ErrSASGenerationFailed, err)
 	}
@@ -216,8 +287,9 @@ func (p *blobDriver) NewTransport(ctx context.Context, connID string, tokens Ses
 	if err != nil {
 		return nil, err
 	}
+	name := p.sessionContainer(connID)
 	t := &blobTransport{
-		connID: connID, containerClient: client.NewContainerClient(connID),
+		connID: connID, container: name, containerClient: client.NewContainerClient(name),
 		cfg: p.cfg, ep: p.ep, isInitiator: isInitiator,
 	}
 	if isInitiator {
@@ -231,6 +303,8 @@ func (p *blobDriver) NewTransport(ctx context.Context, connID string, tokens Ses
 			return nil, fmt.Errorf("create rx blob: %w", err)
 		}
 	}
+	t.local.Store(t.blobAddr(t.rxBlob))
+	t.remote.Store(t.blobAddr(t.txBlob))
 	return t, nil
 }
 
@@ -243,20 +317,85 @@ func (p *blobDriver) CleanupBootstrap(ctx context.Context) error {
 	return nil
 }
 
+// CleanupHandshakeEndpoint removes the handshake endpoint, leaving the token
+// endpoint in place.
+func (p *blobDriver) CleanupHandshakeEndpoint(ctx context.Context) error {
+	if p.client == nil {
+		return nil
+	}
+	_, _ = p.client.NewContainerClient(p.cfg.handshakeEndpoint).Delete(ctx, nil)
+	return nil
+}
+
 func (p *blobDriver) CleanupSession(ctx context.Context, connID string) error {
 	if p.client == nil {
 		return nil
 	}
-	_, _ = p.client.NewContainerClient(connID).Delete(ctx, nil)
+	_, _ = p.client.NewContainerClient(p.sessionContainer(connID)).Delete(ctx, nil)
 	return nil
 }
 
+// TouchSession stamps the session container's metadata.
+func (p *blobDriver) TouchSession(ctx context.Context, connID string) error {
+	if p.client == nil {
+		return nil
+	}
+	_, err := p.client.NewContainerClient(p.sessionContainer(connID)).SetMetadata(ctx, &container.SetMetadataOptions{Metadata: activityMetadata(time.Now())})
+	return err
+}
+
+// ListSessions finds session containers by their connID (UUID) names, after
+// the service prefix if any. A UUID container without an activity stamp only
+// counts as a session if it holds the initial request blob, so unrelated
+// containers are never adopted.
+func (p *blobDriver) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	if p.client == nil {
+		return nil, nil
+	}
+	prefix := p.sessionContainer("")
+	opts := &service.ListContainersOptions{Include: service.ListContainersInclude{Metadata: true}}
+	if prefix != "" {
+		opts.Prefix = &prefix
+	}
+	pager := p.client.NewListContainersPager(opts)
+	var sessions []SessionInfo
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.ContainerItems {
+			if item.Name == nil {
+				continue
+			}
+			connID := strings.TrimPrefix(*item.Name, prefix)
+			if id, err := uuid.Parse(connID); err != nil || id.String() != connID {
+				continue
+			}
+			last, ok := parseActivity(item.Metadata)
+			if !ok {
+				cc := p.client.NewContainerClient(*item.Name)
+				if _, err := cc.NewBlobClient(p.cfg.reqPrefix+"-0").GetProperties(ctx, nil); err != nil {
+					continue
+				}
+				if err := p.TouchSession(ctx, connID); err != nil {
+					continue
+				}
+				last = time.Now()
+			}
+			sessions = append(sessions, SessionInfo{ConnID: connID, LastActive: last})
+		}
+	}
+	return sessions, nil
+}
+
 type blobTransport struct {
 	containerClient *container.Client
 	cfg             *Config
 	ep              *Endpoint
 
 	connID         string
+	container      string // session container, named by sessionContainer
 	txBlob, rxBlob string
 	blocksWritten  int64
 	txOffset       int64 // bytes appended to txBlob; the append-position guard
@@ -264,6 +403,10 @@ type blobTransport struct {
 	txSeq, rxSeq   int
 	mu             sync.Mutex
 	isInitiator    bool
+
+	// local and remote mirror rxBlob and txBlob for LocalAddr and RemoteAddr,
+	// which must not wait on mu while it is held across a storage call.
+	local, remote atomic.Pointer[ServiceAddr]
 }
 
 func (t *blobTransport) WriteRaw(ctx context.Context, seq uint64, data io.ReadSeeker) error {
@@ -315,13 +458,13 @@ func (t *blobTransport) ReadRaw(ctx context.Context) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
-func (t *blobTransport) Close() error    { return nil }
-func (t *blobTransport) MaxRawSize() int { return MaxBlobBlockSize }
-func (t *blobTransport) LocalAddr() net.Addr {
-	return ServiceAddr{blobDriverName, t.ep.ServiceURL(), t.connID + "/" + t.rxBlob}
-}
-func (t *blobTransport) RemoteAddr() net.Addr {
-	return ServiceAddr{blobDriverName, t.ep.ServiceURL(), t.connID + "/" + t.txBlob}
+func (t *blobTransport) Close() error         { return nil }
+func (t *blobTransport) MaxRawSize() int      { return MaxBlobBlockSize }
+func (t *blobTransport) LocalAddr() net.Addr  { return *t.local.Load() }
+func (t *blobTransport) RemoteAddr() net.Addr { return *t.remote.Load() }
+
+func (t *blobTransport) blobAddr(name string) *ServiceAddr {
+	return &ServiceAddr{blobDriverName, t.ep.ServiceURL(), t.container + "/" + name}
 }
 
 func (t *blobTransport) ShouldRotate() bool {
@@ -339,6 +482,7 @@ func (t *blobTransport) RotateTX(ctx context.Context) error {
 		prefix = t.cfg.resPrefix
 	}
 	t.txBlob = prefix + "-" + strconv.Itoa(t.txSeq)
+	t.remote.Store(t.blobAddr(t.txBlob))
 	t.blocksWritten = 0
 	t.txOffset = 0
 	_, err := t.containerClient.NewAppendBlobClient(t.txBlob).Create(ctx, nil)
@@ -354,10 +498,27 @@ func (t *blobTransport) RotateRX() error {
 		prefix = t.cfg.reqPrefix
 	}
 	t.rxBlob = prefix + "-" + strconv.Itoa(t.rxSeq)
+	t.local.Store(t.blobAddr(t.rxBlob))
 	t.rxOffset = 0
 	return nil
 }
 
+// DebugState reports the current blobs and positions. mu is held across
+// storage calls, so a busy transport reports only that.
+func (t *blobTransport) DebugState() map[string]any {
+	if !t.mu.TryLock() {
+		return map[string]any{"busy": true}
+	}
+	defer t.mu.Unlock()
+	return map[string]any{
+		"txBlob":        t.txBlob,
+		"rxBlob":        t.rxBlob,
+		"txOffset":      t.txOffset,
+		"rxOffset":      t.rxOffset,
+		"blocksWritten": t.blocksWritten,
+	}
+}
+
 func newBlobClient(ep *Endpoint) (*service.Client, error) {
 	if ep.Account != "" && ep.Key != "" {
 		cred, err := azblob.NewSharedKeyCredential(ep.Account, ep.Key)
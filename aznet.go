@@ -3,6 +3,7 @@ package aznet
 import (
 	"bytes"
 	"context"
+	"crypto/mlkem"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
@@ -28,12 +30,21 @@ const (
 	MsgTypeFin byte = 0x02
 	// MsgTypeRotate is for rotation notifications.
 	MsgTypeRotate byte = 0x03
+	// MsgTypePong answers a Ping, echoing its payload for RTT measurement.
+	MsgTypePong byte = 0x04
+	// MsgTypeWindow advertises how much data the receiver will accept.
+	MsgTypeWindow byte = 0x05
 )
 
+// pingPayloadSize is the size of the send timestamp carried by Ping frames and
+// echoed in Pongs. Pings from older peers carry no payload and get no reply.
+const pingPayloadSize = 8
+
 // Handshake represents a discovered connection request.
 type Handshake struct {
-	ID      string // handshake identifier (used for cleanup)
-	Payload []byte // The raw Noise handshake message
+	ID      string    // handshake identifier (used for cleanup)
+	Payload []byte    // The raw Noise handshake message; nil if unreadable
+	Created time.Time // when it was stored, if the driver knows; used for expiry
 }
 
 // SessionTokens represents the session-specific tokens/SAS exchanged after handshake.
@@ -51,9 +62,11 @@ type Transport interface {
 	ReadRaw(ctx context.Context) (io.ReadCloser, error)
 	// Close terminates the transport.
 	Close() error
-	// LocalAddr returns the local network address.
+	// LocalAddr returns the address of the resource ReadRaw reads from, the
+	// connection's own inbox.
 	LocalAddr() net.Addr
-	// RemoteAddr returns the remote network address.
+	// RemoteAddr returns the address of the resource WriteRaw writes to, the
+	// peer's inbox.
 	RemoteAddr() net.Addr
 	// MaxRawSize returns the maximum raw capacity of the transport in bytes.
 	// It must be constant for the lifetime of the transport.
@@ -69,6 +82,64 @@ type Rotator interface {
 	RotateRX() error
 }
 
+// HandshakeCanceller is optionally implemented by drivers that let a dialer
+// withdraw a handshake it posted, so that no listener creates a session for a
+// dial that has already failed. A withdrawn handshake must read as malformed,
+// e.g. with an empty payload, so that listeners delete it unanswered.
+type HandshakeCanceller interface {
+	CancelHandshake(ctx context.Context, connID string) error
+}
+
+// HandshakeEndpointCleaner is optionally implemented by drivers that can remove
+// the handshake endpoint alone. With WithEndpointCleanup, Listener.Shutdown uses
+// it to turn new dials away while the token endpoint stays up for dials already
+// answered.
+type HandshakeEndpointCleaner interface {
+	CleanupHandshakeEndpoint(ctx context.Context) error
+}
+
+// HandshakeClaimer is optionally implemented by drivers whose handshake endpoint
+// can be shared by several listener instances (active-active replicas). The
+// listener claims each handshake before allocating a session, so exactly one
+// instance accepts it.
+type HandshakeClaimer interface {
+	// ClaimHandshake takes exclusive ownership of hs for handshakeClaimTTL. It
+	// returns the ID to pass to DeleteHandshake once accepted, or
+	// ErrHandshakeClaimed if another instance already owns it.
+	ClaimHandshake(ctx context.Context, hs Handshake) (string, error)
+	// ReleaseHandshake gives up a claim whose accept failed before the token
+	// was posted, so any instance may accept the handshake again at once.
+	// hs.ID is the ID ClaimHandshake returned. Releasing a claim that has
+	// lapsed or was taken over is not an error.
+	ReleaseHandshake(ctx context.Context, hs Handshake) error
+}
+
+// SessionInfo describes a session's per-connection storage as discovered by a
+// SessionSweeper.
+type SessionInfo struct {
+	ConnID     string
+	LastActive time.Time // when a listener last recorded the session as in use
+}
+
+// SessionSweeper is optionally implemented by drivers that can find session
+// resources left behind by a listener that exited without cleaning up. Live
+// listeners with sweeping enabled touch their sessions every half idleTimeout;
+// a session nobody touches for twice idleTimeout is presumed orphaned and
+// swept.
+type SessionSweeper interface {
+	// TouchSession records that connID is still in use.
+	TouchSession(ctx context.Context, connID string) error
+	// ListSessions returns every session found in the account. A session with
+	// no recorded activity (e.g. created by an older release) is touched and
+	// reported as active now, so it ages out on the normal clock.
+	ListSessions(ctx context.Context) ([]SessionInfo, error)
+}
+
+// handshakeClaimTTL bounds how long a claim survives without being completed. A
+// replica that dies mid-accept loses its claim after this, and the handshake
+// becomes available to the others.
+const handshakeClaimTTL = 60 * time.Second
+
 // ServiceAddr is a reusable net.Addr implementation for all drivers.
 type ServiceAddr struct {
 	Net      string // driver name (e.g. "azblob")
@@ -110,6 +181,13 @@ type Factory interface {
 	NewDriver(ep *Endpoint, cfg *Config) (Driver, error)
 }
 
+// ServiceSeparator is optionally implemented by factories whose resource names
+// cannot contain "-", which otherwise joins a service name (see WithService) to
+// endpoint names and channel prefixes.
+type ServiceSeparator interface {
+	ServiceSeparator() string
+}
+
 var factories = make(map[string]Factory)
 
 var (
@@ -129,12 +207,30 @@ var (
 	ErrWriteBufferFailed = errors.New("failed to write data to buffer")
 	// ErrHandshakeExchangeFailed is returned when the initial handshake message cannot be sent or received.
 	ErrHandshakeExchangeFailed = errors.New("failed to exchange handshake")
+	// ErrListenerUnavailable is returned by Dial when no listener answered
+	// within the connect timeout, or the handshake or token endpoint is gone
+	// because the listener was closed.
+	ErrListenerUnavailable = errors.New("no listener available")
 	// ErrInvalidConfig is returned when the provided options result in an invalid configuration.
 	ErrInvalidConfig = errors.New("invalid configuration")
 	// ErrNoData is returned when no data is available to read.
 	ErrNoData = errors.New("no data available")
 	// ErrFrameTooLarge is returned when a queued frame exceeds one chunk.
 	ErrFrameTooLarge = errors.New("frame exceeds chunk size")
+	// ErrPeerTimeout is returned by Conn reads and writes once nothing, not even a
+	// keep-alive ping, has arrived from the peer for the idle timeout.
+	ErrPeerTimeout = errors.New("peer timed out")
+	// ErrConnNotFound is returned by Listener.CloseConn for an unknown connection ID.
+	ErrConnNotFound = errors.New("connection not found")
+	// ErrHandshakeClaimed is returned when another listener instance already owns a handshake.
+	ErrHandshakeClaimed = errors.New("handshake claimed by another listener")
+	// ErrHandshakeStale is returned for a handshake whose timestamp is missing
+	// or outside the listener's handshake validity window, or that has been in
+	// storage longer than the handshake TTL.
+	ErrHandshakeStale = errors.New("handshake stale")
+	// ErrHandshakeReplayed is returned for a handshake of a connection the
+	// listener already accepted.
+	ErrHandshakeReplayed = errors.New("handshake replayed")
 )
 
 // RegisterFactory registers a factory for the given scheme (e.g., "azblob").
@@ -182,12 +278,37 @@ func initialize(network, address string, opts []Option) (Driver, *Endpoint, *Con
 	}
 	ep := NewEndpoint(u)
 
+	cfg.applyURLParams(u.Query())
+	if err := cfg.validateService(); err != nil {
+		return nil, nil, nil, err
+	}
+	sep := "-"
+	if ss, ok := factory.(ServiceSeparator); ok {
+		sep = ss.ServiceSeparator()
+	}
+	cfg.applyService(sep)
+	if cfg.noiseSuite, err = cfg.cipherSuite.noiseSuite(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if cfg.pricing == nil {
+		p := DefaultPricing(network)
+		cfg.pricing = &p
+	}
+
 	driver, err := factory.NewDriver(ep, cfg)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if wl, ok := driver.(ReceiveWindowLimiter); ok && cfg.receiveWindow > wl.MaxReceiveWindow() {
+		cfg.receiveWindow = wl.MaxReceiveWindow()
+	}
 
-	return &metricsDriver{Driver: driver, m: cfg.metrics}, ep, cfg, nil
+	md := newMetricsDriver(driver, cfg.metrics)
+	if cfg.tracer != nil {
+		return &tracingDriver{metricsDriver: md, cfg: cfg}, ep, cfg, nil
+	}
+	return md, ep, cfg, nil
 }
 
 // Listen is analogous to net.Listen. It takes a network type (e.g. "azblob")
@@ -203,77 +324,177 @@ func Listen(network, address string, opts ...Option) (net.Listener, error) {
 		ep:      ep,
 		driver:  driver,
 		cfg:     cfg,
+		limiter: newAcceptLimiter(cfg.acceptRate, cfg.acceptWindow),
+		replays: newReplayCache(cfg.handshakeMaxAge, cfg.strictHandshakes),
+		poll:    cfg.pollStrategy(cfg.acceptPoll, cfg.acceptPoll),
+
+		stopAccept: make(chan struct{}),
 	}
 
 	go l.janitor()
+	if cfg.sweepInterval > 0 {
+		go l.sweeper()
+	}
 
 	return l, nil
 }
 
 // Dial is analogous to net.Dial. It takes a network type (e.g. "azblob")
 // and an address (e.g. "https://account.blob.core.windows.net/?handshake=...").
-func Dial(network, address string, opts ...Option) (net.Conn, error) {
+func Dial(network, address string, opts ...Option) (_ net.Conn, err error) {
 	driver, _, cfg, err := initialize(network, address, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	connID := uuid.New().String()
-	noise, err := NewNoiseClient()
+	ctx, span := cfg.startSpan(cfg.ctx, "aznet.Dial", attrConnID.String(connID))
+	defer func() {
+		endSpan(span, err)
+		if err != nil {
+			cfg.logger.Warn("aznet: dial failed", "conn_id", connID, "err", err)
+		}
+	}()
+
+	noise, err := newNoise(cfg.noiseSuite, true, cfg.hybridKEM)
 	if err != nil {
 		return nil, err
 	}
-	msg1, err := noise.WriteMessage([]byte(connID))
+	hello := handshakeHello{ID: connID, Data: cfg.handshakeData}
+	if cfg.cipherSuite != CipherSuiteAESGCMSHA256 {
+		hello.Suite = cfg.cipherSuite
+	}
+	var kemKey *mlkem.DecapsulationKey768
+	if cfg.hybridKEM {
+		if kemKey, err = newKEMKey(); err != nil {
+			return nil, err
+		}
+		hello.KEM = kemKey.EncapsulationKey().Bytes()
+	}
+	if cfg.tracer != nil {
+		hello.Trace = make(map[string]string)
+		traceContext.Inject(ctx, propagation.MapCarrier(hello.Trace))
+	}
+	// Only the bare ID reaches every listener, so the dial time rides along
+	// only in a hello that is JSON anyway, unless asked for.
+	if cfg.stampHello || !hello.bare() {
+		hello.Time = time.Now().Unix()
+	}
+	helloPayload, err := hello.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoiseMsgFailed, err)
+	}
+	msg1, err := noise.WriteMessage(helloPayload)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrNoiseMsgFailed, err)
 	}
 
-	if err := driver.PostHandshake(cfg.ctx, connID, msg1); err != nil {
+	err = cfg.retry(ctx, connID, "PostHandshake", nil, func() error {
+		return driver.PostHandshake(ctx, connID, msg1)
+	})
+	if err != nil {
+		if errors.Is(classifyStorageError(err), ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrListenerUnavailable, err)
+		}
 		return nil, fmt.Errorf("%w: %v", ErrHandshakeExchangeFailed, err)
 	}
+	cfg.logger.Debug("aznet: handshake posted, waiting for token", "conn_id", connID)
 
-	dialCtx, dialCancel := context.WithTimeout(cfg.ctx, cfg.connectTimeout)
-	defer dialCancel()
+	encryptedTokens, err := awaitToken(ctx, driver, cfg, connID)
+	if err != nil {
+		// Withdraw the handshake, so a listener that comes by later does not
+		// set up a session nobody will use. Once a token has arrived there is
+		// nothing left to withdraw: the listener accepted the handshake and
+		// deletes it itself.
+		go cancelHandshake(driver, cfg, connID)
+		return nil, err
+	}
 
-	var encryptedTokens []byte
-	for {
-		data, err := driver.GetToken(dialCtx, connID)
-		if err == nil {
-			encryptedTokens = data
-			break
-		}
-		if !errors.Is(err, ErrNoData) {
+	if kemKey != nil {
+		if encryptedTokens, err = noise.decapsulate(kemKey, encryptedTokens); err != nil {
 			return nil, err
 		}
-
-		select {
-		case <-dialCtx.Done():
-			return nil, dialCtx.Err()
-		case <-time.After(cfg.dataPoll):
-		}
 	}
-
 	payload, err := noise.ReadMessage(encryptedTokens)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
 	}
 
-	var tokens SessionTokens
-	if err := json.Unmarshal(payload, &tokens); err != nil {
+	var reply tokenPayload
+	if err := json.Unmarshal(payload, &reply); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrDecodeTokenFailed, err)
 	}
+	tokens := reply.SessionTokens
 
 	if !noise.IsComplete() {
 		return nil, ErrHandshakeIncomplete
 	}
 
-	transport, err := driver.NewTransport(cfg.ctx, connID, tokens, true)
+	transport, err := driver.NewTransport(ctx, connID, tokens, true)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(cfg.ctx)
-	return newConn(ctx, cancel, transport, cfg, noise, driver, connID), nil
+	connCtx, cancel := context.WithCancel(cfg.ctx)
+	cfg.logger.Info("aznet: connected", "conn_id", connID)
+	conn := newConn(connCtx, cancel, transport, cfg, noise, driver, connID)
+	// The listener learns our window from our first Window frame, which goes
+	// ahead of any data we write.
+	conn.setupFlow(cfg.receiveWindow, reply.Window)
+	if conn.flow.limited.Load() {
+		conn.sendWindow(cfg.receiveWindow)
+	}
+	return conn, nil
+}
+
+// awaitToken polls the token endpoint for the listener's reply to connID's
+// handshake until the connect timeout.
+func awaitToken(ctx context.Context, driver Driver, cfg *Config, connID string) ([]byte, error) {
+	dialCtx, dialCancel := context.WithTimeout(ctx, cfg.connectTimeout)
+	defer dialCancel()
+
+	for {
+		data, err := driver.GetToken(dialCtx, connID)
+		if err == nil {
+			return data, nil
+		}
+		if errors.Is(classifyStorageError(err), ErrNotFound) {
+			// The token endpoint is gone: the listener was closed.
+			return nil, fmt.Errorf("%w: %w", ErrListenerUnavailable, err)
+		}
+		if !errors.Is(err, ErrNoData) && !cfg.retryPolicy.retryable(err) {
+			return nil, err
+		}
+
+		select {
+		case <-dialCtx.Done():
+			if ctx.Err() == nil {
+				return nil, fmt.Errorf("%w: no token within %s", ErrListenerUnavailable, cfg.connectTimeout)
+			}
+			return nil, fmt.Errorf("no token from listener: %w", dialCtx.Err())
+		case <-time.After(cfg.dataPoll):
+		}
+	}
+}
+
+// cancelHandshake withdraws a failed dial's handshake where the driver and
+// the bootstrap SAS allow it.
+func cancelHandshake(driver Driver, cfg *Config, connID string) {
+	hc, ok := driver.(HandshakeCanceller)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := hc.CancelHandshake(ctx, connID)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return
+	}
+	if err != nil {
+		cfg.logger.Debug("aznet: withdrawing handshake failed", "conn_id", connID, "err", err)
+		return
+	}
+	cfg.logger.Debug("aznet: handshake withdrawn", "conn_id", connID)
 }
 
 // Conn implements net.Conn.
@@ -289,18 +510,28 @@ type Conn struct {
 	noise    *Noise
 	pending  pendingChunk // sealed chunk awaiting a write retry; guarded by fmu
 	chunkSeq uint64       // next chunk seq to assign; guarded by fmu
-	poll     *AdaptivePoll
+	poll     PollStrategy
 	wake     chan struct{} // buffered(1) nudge from flush() to wake an idle reader
 
 	readDeadline  atomic.Pointer[time.Time]
 	writeDeadline atomic.Pointer[time.Time]
 
-	id string
+	id      string
+	created time.Time
+	stats   *DefaultMetrics // this connection's own traffic; nil if not counted
 
 	lastActive   atomic.Int64
 	peerLastSeen atomic.Int64
 	lastNudge    atomic.Int64 // UnixNano of last reader nudge; rate-limits wakes
 
+	// Round-trip times from ping/pong, in nanoseconds; zero until the first pong.
+	rttLast     atomic.Int64
+	rttMin      atomic.Int64
+	rttSmoothed atomic.Int64
+
+	txRotations atomic.Int64
+	rxRotations atomic.Int64
+
 	cleanupToken sync.Once
 	closeOnce    sync.Once
 	// wmu guards the write buffer (bufs.Write). Acquired briefly inside flush()
@@ -312,12 +543,20 @@ type Conn struct {
 	// fmu serializes flush() calls so only one goroutine encrypts and sends at a
 	// time. Lock order: fmu → wmu (never reverse).
 	fmu sync.Mutex
-
-	closed      atomic.Uint32
-	closedRead  atomic.Uint32
-	closedWrite atomic.Uint32
-	mtu         int
-	readRemain  int
+	// pmu serializes fetch() calls, by Read and by a Write waiting for window,
+	// so chunks are decrypted in order. Held across ReadRaw. Lock order:
+	// pmu → rmu; never taken with wmu or fmu held.
+	pmu sync.Mutex
+
+	flow   flowControl
+	chunks *chunkSizer
+
+	closed       atomic.Uint32
+	closedRead   atomic.Uint32
+	closedWrite  atomic.Uint32
+	peerTimedOut atomic.Uint32
+	mtu          int
+	readRemain   int
 }
 
 // pendingChunk holds a sealed chunk whose write failed, for verbatim resend.
@@ -333,11 +572,12 @@ type pendingChunk struct {
 
 // Buffers encapsulates the internal bytes.Buffer instances used by a connection.
 type Buffers struct {
-	Enc   []byte // Encryption scratch space
-	Dec   []byte // Decryption scratch space
-	Read  bytes.Buffer
-	Write bytes.Buffer
-	Noise bytes.Buffer
+	Enc    []byte // Encryption scratch space
+	Dec    []byte // Decryption scratch space
+	Read   bytes.Buffer
+	Write  bytes.Buffer
+	Noise  bytes.Buffer
+	Ingest bytes.Buffer // decrypted frames not yet sorted into Read
 }
 
 var buffersPool = sync.Pool{
@@ -355,7 +595,7 @@ func newConn(ctx context.Context, cancel context.CancelFunc, t Transport, cfg *C
 	c := &Conn{
 		ctx:       ctx,
 		cancel:    cancel,
-		poll:      NewAdaptivePoll(cfg.fastPoll, cfg.dataPoll),
+		poll:      cfg.pollStrategy(cfg.fastPoll, cfg.dataPoll),
 		transport: t,
 		driver:    driver,
 		id:        connID,
@@ -363,11 +603,16 @@ func newConn(ctx context.Context, cancel context.CancelFunc, t Transport, cfg *C
 		noise:     noise,
 		wake:      make(chan struct{}, 1),
 		bufs:      buffersPool.Get().(*Buffers),
-		mtu:       t.MaxRawSize() - NoiseOverhead - FrameHeaderSize,
+		created:   now,
 	}
+	c.chunks = newChunkSizer(cfg, t.MaxRawSize())
+	c.mtu = c.chunks.max - NoiseOverhead - FrameHeaderSize
 	if r, ok := t.(Rotator); ok {
 		c.rotator = r
 	}
+	if mt, ok := t.(interface{ connStats() *DefaultMetrics }); ok {
+		c.stats = mt.connStats()
+	}
 	c.peerLastSeen.Store(now.UnixNano())
 	c.lastActive.Store(now.UnixNano())
 
@@ -378,29 +623,22 @@ func newConn(ctx context.Context, cancel context.CancelFunc, t Transport, cfg *C
 	return c
 }
 
+// Read implements net.Conn. Errors other than io.EOF are *OpError.
 func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.read(p)
+	return n, c.opError("read", err)
+}
+
+func (c *Conn) read(p []byte) (int, error) {
 	for {
 		if c.closed.Load() == 1 {
 			return 0, net.ErrClosed
 		}
 
 		c.rmu.Lock()
-		if c.closedRead.Load() == 1 {
+		if err := c.readable(); err != nil {
 			c.rmu.Unlock()
-			return 0, io.EOF
-		}
-		// Close() recycles bufs into the shared pool while holding rmu, so a
-		// non-nil check under the lock is what keeps this read off a buffer that
-		// now belongs to another connection.
-		if c.bufs == nil {
-			c.rmu.Unlock()
-			return 0, net.ErrClosed
-		}
-
-		deadline := c.readDeadline.Load()
-		if deadline != nil && !deadline.IsZero() && time.Now().After(*deadline) {
-			c.rmu.Unlock()
-			return 0, os.ErrDeadlineExceeded
+			return 0, err
 		}
 
 		// Drain leftover payload from a previous partial read.
@@ -408,6 +646,7 @@ func (c *Conn) Read(p []byte) (int, error) {
 			n := copy(p, c.bufs.Read.Next(min(c.readRemain, len(p))))
 			c.readRemain -= n
 			c.rmu.Unlock()
+			c.consume(n)
 			return n, nil
 		}
 
@@ -426,24 +665,15 @@ func (c *Conn) Read(p []byte) (int, error) {
 					n := copy(p, c.bufs.Read.Next(min(fLen, len(p))))
 					c.readRemain = fLen - n
 					c.rmu.Unlock()
+					c.consume(n)
 					return n, nil
-				case MsgTypePing:
-					c.bufs.Read.Next(FrameHeaderSize + fLen)
-					c.rmu.Unlock()
-					continue
 				case MsgTypeFin:
 					c.bufs.Read.Next(FrameHeaderSize + fLen)
 					c.closedRead.Store(1)
 					c.rmu.Unlock()
 					return 0, io.EOF
-				case MsgTypeRotate:
-					c.bufs.Read.Next(FrameHeaderSize + fLen)
-					if c.rotator != nil {
-						_ = c.rotator.RotateRX()
-					}
-					c.rmu.Unlock()
-					continue
 				default:
+					// Control frames are handled at ingest; skip anything else.
 					c.bufs.Read.Next(FrameHeaderSize + fLen)
 					c.rmu.Unlock()
 					continue
@@ -453,99 +683,270 @@ func (c *Conn) Read(p []byte) (int, error) {
 
 		c.rmu.Unlock()
 
-		// Fetch more data
-		rawStream, err := c.transport.ReadRaw(c.ctx)
-		if err != nil {
-			if errors.Is(err, ErrNoData) {
-				if !c.idleWait() {
-					return 0, os.ErrDeadlineExceeded
-				}
-				continue
-			}
-			if errors.Is(err, context.Canceled) && c.closed.Load() == 1 {
-				return 0, net.ErrClosed
-			}
+		if err := c.awaitData(); err != nil {
 			return 0, err
 		}
+	}
+}
 
-		// Read directly from the stream into the Noise buffer, then decrypt.
-		// Both touch bufs, so they run under rmu; the blocking ReadRaw above
-		// deliberately does not.
-		c.rmu.Lock()
-		if c.bufs == nil {
-			c.rmu.Unlock()
-			rawStream.Close()
-			return 0, net.ErrClosed
+// readable reports why nothing can be read right now, or nil. Caller must hold
+// rmu.
+func (c *Conn) readable() error {
+	if c.closedRead.Load() == 1 {
+		return io.EOF
+	}
+	// Close() recycles bufs into the shared pool while holding rmu, so a
+	// non-nil check under the lock is what keeps this read off a buffer that
+	// now belongs to another connection.
+	if c.bufs == nil {
+		return net.ErrClosed
+	}
+
+	deadline := c.readDeadline.Load()
+	if deadline != nil && !deadline.IsZero() && time.Now().After(*deadline) {
+		return os.ErrDeadlineExceeded
+	}
+	if c.peerTimedOut.Load() == 1 {
+		return ErrPeerTimeout
+	}
+	return nil
+}
+
+// awaitData fetches the next chunk for a reader that found the read buffer
+// empty, idling between empty polls. A nil return means the caller should look
+// again.
+func (c *Conn) awaitData() error {
+	err := c.fetch()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrNoData) {
+		if c.peerExpired() {
+			c.markPeerIdle()
+			return ErrPeerTimeout
 		}
+		if !c.idleWait() {
+			return os.ErrDeadlineExceeded
+		}
+		return nil
+	}
+	if errors.Is(err, context.Canceled) && c.closed.Load() == 1 {
+		return net.ErrClosed
+	}
+	return err
+}
 
-		_, err = c.bufs.Noise.ReadFrom(rawStream)
+// fetch reads the next raw chunk from the transport, decrypts it and ingests
+// its frames. It returns ErrNoData after an empty poll.
+func (c *Conn) fetch() error {
+	c.pmu.Lock()
+	var rawStream io.ReadCloser
+	err := c.retry("ReadRaw", &c.readDeadline, func() (err error) {
+		observePoll(c.poll)
+		rawStream, err = c.transport.ReadRaw(c.ctx)
+		return err
+	})
+	if err != nil {
+		c.pmu.Unlock()
+		return err
+	}
+
+	// Read directly from the stream into the Noise buffer, then decrypt.
+	// Both touch bufs, so they run under rmu; the blocking ReadRaw above
+	// deliberately does not.
+	c.rmu.Lock()
+	if c.bufs == nil {
+		c.rmu.Unlock()
+		c.pmu.Unlock()
 		rawStream.Close()
-		if err != nil && err != io.EOF {
-			c.rmu.Unlock()
-			return 0, err
+		return net.ErrClosed
+	}
+
+	_, err = c.bufs.Noise.ReadFrom(rawStream)
+	rawStream.Close()
+	if err != nil && err != io.EOF {
+		c.rmu.Unlock()
+		c.pmu.Unlock()
+		return err
+	}
+
+	var pongs [][pingPayloadSize]byte
+	maxChunk := c.transport.MaxRawSize()
+	for {
+		decrypted, rest, err := c.noise.UnsealData(c.bufs.Dec, c.bufs.Noise.Bytes(), maxChunk)
+		if err != nil {
+			if err != io.ErrShortBuffer {
+				c.rmu.Unlock()
+				c.pmu.Unlock()
+				return err
+			}
+			break
 		}
 
-		maxChunk := c.transport.MaxRawSize()
-		for {
-			decrypted, rest, err := c.noise.UnsealData(c.bufs.Dec, c.bufs.Noise.Bytes(), maxChunk)
-			if err != nil {
-				if err != io.ErrShortBuffer {
-					c.rmu.Unlock()
-					return 0, err
-				}
-				break
+		c.bufs.Dec = decrypted[:0]
+		c.peerLastSeen.Store(time.Now().UnixNano())
+
+		c.cleanupToken.Do(func() {
+			if !c.noise.IsInitiator() && c.driver != nil {
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					defer cancel()
+					if err := c.driver.DeleteToken(ctx, c.id); err != nil {
+						c.cfg.logger.Warn("aznet: deleting token failed", "conn_id", c.id, "err", err)
+					}
+				}()
 			}
+		})
 
-			c.bufs.Dec = decrypted[:0]
+		pongs = c.ingest(decrypted, pongs)
+		used := c.bufs.Noise.Len() - len(rest)
+		c.bufs.Noise.Next(used)
+	}
+	c.rmu.Unlock()
+	c.pmu.Unlock()
 
-			c.cleanupToken.Do(func() {
-				if !c.noise.IsInitiator() && c.driver != nil {
-					go func() {
-						ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-						defer cancel()
-						_ = c.driver.DeleteToken(ctx, c.id)
-					}()
-				}
-			})
+	// Queuing a reply takes wmu, so it waits until rmu is released.
+	for _, stamp := range pongs {
+		c.sendPong(stamp[:])
+	}
+	c.poll.Reset()
+	if o, ok := c.poll.(TrafficObserver); ok {
+		o.ObserveReceive()
+	}
+	return nil
+}
 
-			c.bufs.Read.Write(decrypted)
-			used := c.bufs.Noise.Len() - len(rest)
-			c.bufs.Noise.Next(used)
+// ingest sorts decrypted frames: data and FIN go to the read buffer in order,
+// control frames take effect right away, so that a Write blocked on window can
+// see an update queued behind data nobody is reading. It returns pongs with the
+// stamps of pings to answer. Caller must hold rmu.
+func (c *Conn) ingest(plain []byte, pongs [][pingPayloadSize]byte) [][pingPayloadSize]byte {
+	in := &c.bufs.Ingest
+	in.Write(plain)
+	for in.Len() >= FrameHeaderSize {
+		header := in.Bytes()[:FrameHeaderSize]
+		fType := header[4]
+		fLen := int(binary.BigEndian.Uint32(header[:4]))
+		if in.Len() < FrameHeaderSize+fLen {
+			break // frame continues in the next chunk
+		}
+
+		switch fType {
+		case MsgTypeData, MsgTypeFin:
+			c.bufs.Read.Write(in.Next(FrameHeaderSize + fLen))
+		case MsgTypePing:
+			in.Next(FrameHeaderSize)
+			payload := in.Next(fLen)
+			if fLen == pingPayloadSize {
+				pongs = append(pongs, [pingPayloadSize]byte(payload))
+			}
+		case MsgTypePong:
+			in.Next(FrameHeaderSize)
+			payload := in.Next(fLen)
+			if fLen == pingPayloadSize {
+				sent := int64(binary.BigEndian.Uint64(payload))
+				c.recordRTT(time.Duration(time.Now().UnixNano() - sent))
+			}
+		case MsgTypeWindow:
+			in.Next(FrameHeaderSize)
+			payload := in.Next(fLen)
+			if fLen == windowPayloadSize {
+				c.flow.raiseLimit(int64(binary.BigEndian.Uint64(payload)))
+			}
+		case MsgTypeRotate:
+			in.Next(FrameHeaderSize + fLen)
+			c.rotateRX()
+		default:
+			in.Next(FrameHeaderSize + fLen)
 		}
-		c.rmu.Unlock()
-		c.poll.Reset()
 	}
+	return pongs
 }
 
-func (c *Conn) Write(p []byte) (int, error) {
-	if c.closed.Load() == 1 || c.closedWrite.Load() == 1 {
-		return 0, io.ErrClosedPipe
+// rotateRX follows the peer to its next channel. Caller must hold rmu.
+func (c *Conn) rotateRX() {
+	if c.rotator == nil {
+		return
 	}
-	deadline := c.writeDeadline.Load()
-	if deadline != nil && !deadline.IsZero() && time.Now().After(*deadline) {
-		return 0, os.ErrDeadlineExceeded
+	if err := c.rotator.RotateRX(); err != nil {
+		c.cfg.logger.Warn("aznet: rotating receive channel failed", "conn_id", c.id, "err", err)
+		return
+	}
+	c.cfg.logger.Debug("aznet: rotated receive channel", "conn_id", c.id)
+	c.rxRotations.Add(1)
+	if h := c.cfg.hooks.OnRotate; h != nil {
+		h(c.id, false)
 	}
+}
 
-	total := len(p)
-	c.wmu.Lock()
-	if c.bufs == nil {
-		c.wmu.Unlock()
-		return 0, io.ErrClosedPipe
+// Write implements net.Conn. Errors are *OpError.
+func (c *Conn) Write(p []byte) (int, error) {
+	n, err := c.write(p)
+	return n, c.opError("write", err)
+}
+
+func (c *Conn) write(p []byte) (int, error) {
+	if err := c.writable(); err != nil {
+		return 0, err
 	}
-	for len(p) > 0 {
-		chunkSize := min(len(p), int(c.mtu))
-		BuildFrame(&c.bufs.Write, Frame{Type: MsgTypeData, Payload: p[:chunkSize]})
-		p = p[chunkSize:]
+
+	// Queue as much as the peer's window allows, send it, and wait for more
+	// window until all of p is queued.
+	sent := 0
+	for {
+		c.wmu.Lock()
+		if c.bufs == nil {
+			c.wmu.Unlock()
+			return sent, io.ErrClosedPipe
+		}
+		queued := 0
+		for len(p) > 0 {
+			chunkSize := min(len(p), c.chunks.frameSize(), c.flow.allowance())
+			if chunkSize <= 0 {
+				break
+			}
+			BuildFrame(&c.bufs.Write, Frame{Type: MsgTypeData, Payload: p[:chunkSize]})
+			c.flow.sent += int64(chunkSize)
+			p = p[chunkSize:]
+			queued += chunkSize
+		}
+		limit := c.flow.sent
+		c.wmu.Unlock()
+
+		if err := c.flush(); err != nil {
+			return sent, err
+		}
+		sent += queued
+		if len(p) == 0 {
+			return sent, nil
+		}
+		if err := c.waitWindow(limit); err != nil {
+			return sent, err
+		}
 	}
-	c.wmu.Unlock()
+}
 
-	if err := c.flush(); err != nil {
-		return 0, err
+// writable reports why nothing can be written right now, or nil.
+func (c *Conn) writable() error {
+	if c.closed.Load() == 1 || c.closedWrite.Load() == 1 {
+		return io.ErrClosedPipe
+	}
+	if c.peerTimedOut.Load() == 1 {
+		return ErrPeerTimeout
 	}
-	return total, nil
+	deadline := c.writeDeadline.Load()
+	if deadline != nil && !deadline.IsZero() && time.Now().After(*deadline) {
+		return os.ErrDeadlineExceeded
+	}
+	return nil
 }
 
 func (c *Conn) Close() error {
+	return c.close(CloseLocal)
+}
+
+// close closes the connection once, reporting reason to the OnClose hook.
+func (c *Conn) close(reason CloseReason) error {
 	var err error
 	c.closeOnce.Do(func() {
 		c.closed.Store(1)
@@ -573,6 +974,7 @@ func (c *Conn) Close() error {
 			c.bufs.Read.Reset()
 			c.bufs.Write.Reset()
 			c.bufs.Noise.Reset()
+			c.bufs.Ingest.Reset()
 			c.bufs.Enc = c.bufs.Enc[:0]
 			c.bufs.Dec = c.bufs.Dec[:0]
 			buffersPool.Put(c.bufs)
@@ -582,10 +984,25 @@ func (c *Conn) Close() error {
 		c.rmu.Unlock()
 		c.wmu.Unlock()
 		c.fmu.Unlock()
+
+		if h := c.cfg.hooks.OnClose; h != nil {
+			h(c.id, reason)
+		}
 	})
 	return err
 }
 
+// markPeerIdle records that the peer has gone silent, reporting it once.
+func (c *Conn) markPeerIdle() {
+	if c.peerTimedOut.Swap(1) == 1 {
+		return
+	}
+	c.cfg.logger.Info("aznet: peer timed out", "conn_id", c.id, "last_seen", c.PeerLastSeen())
+	if h := c.cfg.hooks.OnPeerIdle; h != nil {
+		h(c.id)
+	}
+}
+
 // CloseWrite shuts down the writing side of the connection. It sends a FIN frame
 // to the peer to indicate that no more data will be sent.
 func (c *Conn) CloseWrite() error {
@@ -623,15 +1040,33 @@ func (c *Conn) SetWriteDeadline(t time.Time) error {
 }
 
 // MTU returns the maximum number of application bytes that can fit in a single
-// transport frame for the current connection.
+// transport frame for the current connection, after any WithMaxChunkSize cap.
+// Adaptive chunk sizing may use smaller frames.
 func (c *Conn) MTU() int {
 	return c.mtu
 }
 
 func (c *Conn) GetMetrics() Metrics { return c.cfg.metrics }
 
+// PeerLastSeen returns when a frame, data or keep-alive, last arrived from the
+// peer. Arrival is observed while the connection is being read, and by the
+// keep-alive once the peer seems to have gone silent.
+func (c *Conn) PeerLastSeen() time.Time {
+	return time.Unix(0, c.peerLastSeen.Load())
+}
+
+// peerExpired reports whether the peer has been silent for the idle timeout.
+// Only meaningful while keep-alive is on: without pings an idle but healthy
+// peer is indistinguishable from a dead one.
+func (c *Conn) peerExpired() bool {
+	if c.cfg.pingInterval <= 0 || c.cfg.idleTimeout <= 0 {
+		return false
+	}
+	return time.Since(c.PeerLastSeen()) > c.cfg.idleTimeout
+}
+
 // keepAlive sends a Ping frame whenever nothing has been flushed for a full
-// pingInterval.
+// pingInterval, and probes a peer that seems to have gone silent.
 func (c *Conn) keepAlive() {
 	ticker := time.NewTicker(c.cfg.pingInterval)
 	defer ticker.Stop()
@@ -643,6 +1078,9 @@ func (c *Conn) keepAlive() {
 			if c.closed.Load() == 1 || c.closedWrite.Load() == 1 {
 				return
 			}
+			if c.peerExpired() && c.probePeer() {
+				return
+			}
 			last := c.lastActive.Load()
 			if time.Since(time.Unix(0, last)) >= c.cfg.pingInterval {
 				c.wmu.Lock()
@@ -650,7 +1088,9 @@ func (c *Conn) keepAlive() {
 					c.wmu.Unlock()
 					return
 				}
-				BuildFrame(&c.bufs.Write, Frame{Type: MsgTypePing})
+				var stamp [pingPayloadSize]byte
+				binary.BigEndian.PutUint64(stamp[:], uint64(time.Now().UnixNano()))
+				BuildFrame(&c.bufs.Write, Frame{Type: MsgTypePing, Payload: stamp[:]})
 				c.wmu.Unlock()
 				_ = c.flush()
 				continue
@@ -659,10 +1099,88 @@ func (c *Conn) keepAlive() {
 	}
 }
 
+// probePeer fetches once from a peer whose last frame is older than the idle
+// timeout and marks it idle if nothing arrives, so that writes on a connection
+// nobody reads fail too. It reports whether the peer was marked idle.
+func (c *Conn) probePeer() bool {
+	if err := c.fetch(); err != nil && !errors.Is(err, ErrNoData) {
+		return false
+	}
+	if !c.peerExpired() {
+		return false
+	}
+	c.markPeerIdle()
+	return true
+}
+
+// sendPong echoes a ping's timestamp back to the peer. The flush runs in the
+// background so a ping never stalls the Read that found it. Must not be called
+// with rmu held: queuing takes wmu, which orders before rmu.
+func (c *Conn) sendPong(stamp []byte) {
+	if c.closed.Load() == 1 || c.closedWrite.Load() == 1 {
+		return
+	}
+	c.wmu.Lock()
+	if c.bufs == nil {
+		c.wmu.Unlock()
+		return
+	}
+	BuildFrame(&c.bufs.Write, Frame{Type: MsgTypePong, Payload: stamp})
+	c.wmu.Unlock()
+	go func() { _ = c.flush() }()
+}
+
+// RTTStats summarizes round-trip times measured with ping/pong frames. Each
+// sample includes the peer's poll delay, i.e. the latency an application
+// actually sees over the storage path. Zero values mean no sample yet.
+type RTTStats struct {
+	Last     time.Duration
+	Min      time.Duration
+	Smoothed time.Duration // exponentially weighted, gain 1/8 as in RFC 6298
+}
+
+// RTT returns the round-trip times measured so far. Samples are taken from
+// keep-alive pings, so none are taken when keep-alive is disabled.
+func (c *Conn) RTT() RTTStats {
+	return RTTStats{
+		Last:     time.Duration(c.rttLast.Load()),
+		Min:      time.Duration(c.rttMin.Load()),
+		Smoothed: time.Duration(c.rttSmoothed.Load()),
+	}
+}
+
+// recordRTT folds one sample into the connection's RTT stats and forwards it to
+// the metrics collector if it records RTT. Called under rmu, so samples are
+// never folded concurrently.
+func (c *Conn) recordRTT(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.rttLast.Store(int64(d))
+	if m := c.rttMin.Load(); m == 0 || int64(d) < m {
+		c.rttMin.Store(int64(d))
+	}
+	if srtt := c.rttSmoothed.Load(); srtt == 0 {
+		c.rttSmoothed.Store(int64(d))
+	} else {
+		c.rttSmoothed.Store(srtt + (int64(d)-srtt)/8)
+	}
+	if r, ok := c.cfg.metrics.(RTTRecorder); ok {
+		r.RecordRTT(d)
+	}
+	if o, ok := c.poll.(TrafficObserver); ok {
+		o.ObserveRTT(d)
+	}
+}
+
 func (c *Conn) flush() error {
 	c.fmu.Lock()
 	defer c.fmu.Unlock()
+	return c.flushLocked()
+}
 
+// flushLocked sends everything queued in the write buffer. Caller must hold fmu.
+func (c *Conn) flushLocked() error {
 	if c.bufs == nil {
 		return net.ErrClosed
 	}
@@ -676,7 +1194,7 @@ func (c *Conn) flush() error {
 	}
 
 	// Derived from mtu so the largest frame always fits in one chunk.
-	maxChunk := int(c.mtu) + FrameHeaderSize
+	maxChunk := c.mtu + FrameHeaderSize
 
 	for {
 		c.wmu.Lock()
@@ -688,24 +1206,18 @@ func (c *Conn) flush() error {
 		// Always at a frame boundary, since chunking below is frame-aligned.
 		if c.rotator != nil && c.rotator.ShouldRotate() {
 			c.wmu.Unlock()
-
-			// Send rotation frame
-			var rBuf bytes.Buffer
-			BuildFrame(&rBuf, Frame{Type: MsgTypeRotate})
-
-			sealed, err := c.noise.SealData(c.bufs.Enc, rBuf.Bytes())
-			if err != nil {
-				return err
-			}
-			c.bufs.Enc = sealed[:0]
-
-			if err := c.sendChunk(sealed, 0, true, c.chunkSeq); err != nil {
+			if err := c.sendRotate(); err != nil {
 				return err
 			}
 			continue // Re-check buffer after rotation
 		}
 
-		takeLen := alignedChunkLen(c.bufs.Write.Bytes(), maxChunk)
+		// Pack up to the current target; a frame queued while the target was
+		// larger still goes out whole.
+		takeLen := alignedChunkLen(c.bufs.Write.Bytes(), c.chunks.target()-NoiseOverhead)
+		if takeLen == 0 {
+			takeLen = alignedChunkLen(c.bufs.Write.Bytes(), maxChunk)
+		}
 		if takeLen == 0 {
 			// Framing is already broken; an unaligned chunk would hide it.
 			c.wmu.Unlock()
@@ -720,22 +1232,50 @@ func (c *Conn) flush() error {
 			return err
 		}
 		c.bufs.Enc = sealed[:0]
+		c.chunks.observe(takeLen, c.bufs.Write.Len() > takeLen)
 		c.wmu.Unlock()
 
 		if err := c.sendChunk(sealed, takeLen, false, c.chunkSeq); err != nil {
 			return err
 		}
+		c.chunkSent()
+	}
+}
+
+// sendRotate sends a Rotate frame in a chunk of its own and moves to the next
+// send channel. Caller must hold fmu and must not hold wmu.
+func (c *Conn) sendRotate() error {
+	var rBuf bytes.Buffer
+	BuildFrame(&rBuf, Frame{Type: MsgTypeRotate})
 
-		c.lastActive.Store(time.Now().UnixNano())
-		c.nudgeReader()
+	sealed, err := c.noise.SealData(c.bufs.Enc, rBuf.Bytes())
+	if err != nil {
+		return err
 	}
+	c.bufs.Enc = sealed[:0]
+
+	return c.sendChunk(sealed, 0, true, c.chunkSeq)
+}
+
+// chunkSent records that a data chunk went out.
+func (c *Conn) chunkSent() {
+	c.lastActive.Store(time.Now().UnixNano())
+	if o, ok := c.poll.(TrafficObserver); ok {
+		o.ObserveSend()
+	}
+	c.nudgeReader()
 }
 
 // sendChunk writes one sealed chunk, consuming the plaintext it covered and
 // applying any rotation only once the write lands; a failure leaves both queued
 // for retry. Caller must hold fmu and must not hold wmu.
 func (c *Conn) sendChunk(sealed []byte, consume int, rotate bool, seq uint64) error {
-	if err := c.transport.WriteRaw(c.ctx, seq, bytes.NewReader(sealed)); err != nil {
+	err := c.retry("WriteRaw", &c.writeDeadline, func() error {
+		return c.transport.WriteRaw(c.ctx, seq, bytes.NewReader(sealed))
+	})
+	if err != nil {
+		c.cfg.logger.Warn("aznet: chunk write failed, will retry on next flush",
+			"conn_id", c.id, "seq", seq, "err", err)
 		if !c.pending.valid {
 			// Copy, because sealed aliases bufs.Enc and the next seal reuses it.
 			c.pending.data = append(c.pending.data[:0], sealed...)
@@ -756,7 +1296,15 @@ func (c *Conn) sendChunk(sealed []byte, consume int, rotate bool, seq uint64) er
 		c.wmu.Unlock()
 	}
 	if rotate {
-		return c.rotator.RotateTX(c.ctx)
+		if err := c.rotator.RotateTX(c.ctx); err != nil {
+			c.cfg.logger.Warn("aznet: rotating send channel failed", "conn_id", c.id, "err", err)
+			return err
+		}
+		c.cfg.logger.Debug("aznet: rotated send channel", "conn_id", c.id)
+		c.txRotations.Add(1)
+		if h := c.cfg.hooks.OnRotate; h != nil {
+			h(c.id, true)
+		}
 	}
 	return nil
 }
@@ -785,6 +1333,10 @@ func (c *Conn) nudgeReader() {
 // deadline expires. It returns false only when the read deadline has passed.
 func (c *Conn) idleWait() bool {
 	d := c.poll.Next()
+	overBudget := c.cfg.overBudget()
+	if overBudget {
+		d = max(d, c.cfg.dataPoll*overBudgetPollFactor)
+	}
 	if d <= 0 {
 		return true // post-activity fast path: retry immediately
 	}
@@ -803,16 +1355,37 @@ func (c *Conn) idleWait() bool {
 		deadlineCh = dt.C
 	}
 
-	select {
-	case <-c.ctx.Done():
-		return true // loop observes closed/ctx and returns appropriately
-	case <-c.wake:
-		c.poll.Reset()
-		return true
-	case <-pollTimer.C:
-		return true
-	case <-deadlineCh:
-		return false
+	// Nudges exist to poll sooner, which is what an exhausted budget forbids.
+	wake := c.wake
+	if overBudget {
+		wake = nil
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return true // loop observes closed/ctx and returns appropriately
+		case <-wake:
+			// The strategy has the last word on polling early; a refused
+			// nudge is spent and the full interval waited out.
+			if g, ok := c.poll.(WakeGate); ok && !g.AllowWake() {
+				wake = nil
+				continue
+			}
+			c.poll.Reset()
+			return true
+		case <-pollTimer.C:
+			return true
+		case <-deadlineCh:
+			return false
+		}
+	}
+}
+
+// observePoll tells p that a read transaction is about to be made.
+func observePoll(p PollStrategy) {
+	if o, ok := p.(TrafficObserver); ok {
+		o.ObservePoll()
 	}
 }
 
@@ -823,8 +1396,19 @@ type Listener struct {
 	driver  Driver
 	cfg     *Config
 	conns   sync.Map // map[string]*Conn
+	active  atomic.Int64
+	limiter *acceptLimiter // nil when accepts are not rate limited
+	replays *replayCache   // nil when handshake freshness is not checked
+	poll    PollStrategy   // paces handshake scans
+
+	shuttingDown atomic.Bool   // set by Shutdown; Accept refuses new handshakes
+	stopAccept   chan struct{} // closed by Shutdown to cut short Accept's wait
 }
 
+// shutdownPollInterval is how often Shutdown checks whether the remaining
+// connections have finished.
+const shutdownPollInterval = 500 * time.Millisecond
+
 func (l *Listener) Accept() (net.Conn, error) {
 	for {
 		select {
@@ -832,71 +1416,266 @@ func (l *Listener) Accept() (net.Conn, error) {
 			return nil, net.ErrClosed
 		default:
 		}
+		if l.shuttingDown.Load() {
+			return nil, net.ErrClosed
+		}
+
+		// At capacity or over budget, don't even list: pending handshakes are
+		// left for other instances, or for us once a slot or budget frees up.
+		if (l.cfg.maxConns > 0 && l.active.Load() >= int64(l.cfg.maxConns)) || l.cfg.overBudget() {
+			l.idleWait()
+			continue
+		}
 
+		observePoll(l.poll)
 		handshakes, err := l.driver.GetHandshakes(l.cfg.ctx)
 		if err != nil {
-			time.Sleep(l.cfg.acceptPoll)
+			l.cfg.logger.Warn("aznet: listing handshakes failed", "err", err)
+			l.idleWait()
 			continue
 		}
 
-		for _, hs := range handshakes {
-			noise, err := NewNoiseServer()
-			if err != nil {
-				continue
+		for i, hs := range handshakes {
+			if l.shuttingDown.Load() {
+				// Listing may have claimed what it returned, e.g. hidden
+				// queue messages; hand the rest to the other replicas.
+				l.releaseHandshakes(handshakes[i:])
+				return nil, net.ErrClosed
 			}
-			payload, err := noise.ReadMessage(hs.Payload)
-			if err != nil {
-				continue
+			conn, err := l.acceptHandshake(hs)
+			if errors.Is(err, errAcceptLimited) {
+				// Over the rate limit the rest of this batch stays pending
+				// for the next window.
+				break
 			}
-
-			// The payload contains the actual connID from the client.
-			connID := string(payload)
-			if connID == "" {
+			if err != nil || conn == nil {
 				continue
 			}
+			return conn, nil
+		}
+		l.idleWait()
+	}
+}
 
-			// Check if we already have this connection
-			if _, ok := l.conns.Load(connID); ok {
-				continue
-			}
+// errAcceptLimited stops Accept from working through a batch of handshakes once
+// the accept rate limit is hit.
+var errAcceptLimited = errors.New("accept rate limit reached")
+
+// acceptHandshake turns one pending handshake into a connection. It returns a
+// nil Conn and nil error for handshakes that are skipped without being
+// answered, e.g. because the connection already exists.
+func (l *Listener) acceptHandshake(hs Handshake) (_ *Conn, err error) {
+	var connID string
+	defer func() {
+		switch {
+		case err == nil, errors.Is(err, errAcceptLimited):
+		case errors.Is(err, ErrHandshakeClaimed):
+			l.cfg.logger.Debug("aznet: handshake claimed by another listener", "conn_id", connID, "handshake", hs.ID)
+		default:
+			l.cfg.logger.Warn("aznet: handshake rejected", "conn_id", connID, "handshake", hs.ID, "err", err)
+		}
+	}()
 
-			// Generate tokens (driver specific tokens via Provider)
-			tokens, err := l.driver.CreateSession(l.cfg.ctx, connID)
-			if err != nil {
-				continue
-			}
-			encodedTokens, err := json.Marshal(tokens)
-			if err != nil {
-				continue
-			}
+	// Handshakes that can never be accepted are deleted, or every scan would
+	// list and process them again.
+	if l.cfg.handshakeTTL > 0 && !hs.Created.IsZero() && time.Since(hs.Created) > l.cfg.handshakeTTL {
+		return nil, l.quarantine(hs, fmt.Errorf("%w: stored %s", ErrHandshakeStale, hs.Created.UTC().Format(time.RFC3339)))
+	}
+	if len(hs.Payload) == 0 {
+		return nil, l.quarantine(hs, fmt.Errorf("%w: empty payload", ErrHandshakeFailed))
+	}
 
-			msg2, err := noise.WriteMessage(encodedTokens)
-			if err != nil {
-				continue
-			}
+	noise, err := newNoise(l.cfg.noiseSuite, false, l.cfg.hybridKEM)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := noise.ReadMessage(hs.Payload)
+	if err != nil {
+		return nil, l.quarantine(hs, fmt.Errorf("%w: %v", ErrHandshakeFailed, err))
+	}
 
-			if err := l.driver.PostToken(l.cfg.ctx, connID, msg2); err != nil {
-				continue
-			}
+	// The payload carries the client's connID, and possibly its trace context.
+	hello, err := parseHandshakeHello(payload)
+	if err != nil {
+		return nil, l.quarantine(hs, err)
+	}
+	connID = hello.ID
 
-			if !noise.IsComplete() {
-				continue
-			}
+	// Message 1 reads the same under any suite, so a mismatch only shows here;
+	// answering would leave the client unable to decrypt message 2.
+	suite, err := hello.Suite.noiseSuite()
+	if err != nil {
+		return nil, l.quarantine(hs, err)
+	}
+	if !bytes.Equal(suite.Name(), l.cfg.noiseSuite.Name()) {
+		return nil, l.quarantine(hs, fmt.Errorf("%w: client uses %s", ErrCipherSuiteMismatch, suite.Name()))
+	}
+	if l.cfg.hybridKEM != (len(hello.KEM) > 0) {
+		return nil, l.quarantine(hs, ErrKeyExchangeMismatch)
+	}
 
-			// Inform Provider we are done and want a transport
-			transport, err := l.driver.NewTransport(l.cfg.ctx, connID, tokens, false)
-			if err != nil {
-				continue
-			}
+	// A handshake of a connection we already have is left over from its
+	// accept, whose delete failed.
+	if _, ok := l.conns.Load(connID); ok {
+		_ = l.quarantine(hs, nil)
+		return nil, nil
+	}
 
-			_ = l.driver.DeleteHandshake(l.cfg.ctx, hs.ID)
-			ctx, cancel := context.WithCancel(l.cfg.ctx)
-			conn := newConn(ctx, cancel, transport, l.cfg, noise, l.driver, connID)
-			l.conns.Store(connID, conn)
-			return conn, nil
+	// Anything else must be fresh and new; a replayed or lingering handshake
+	// would otherwise get a session of its own.
+	if err := l.replays.check(connID, hello.stamp()); err != nil {
+		return nil, l.quarantine(hs, err)
+	}
+
+	if l.cfg.acceptFilter != nil {
+		if err := l.cfg.acceptFilter(connID, hello.Data); err != nil {
+			return nil, l.quarantine(hs, fmt.Errorf("accept filter: %w", err))
+		}
+	}
+
+	if !l.limiter.allow() {
+		return nil, errAcceptLimited
+	}
+	// The slot is only spent on a handshake that becomes a connection, not
+	// on one another replica claims or whose session can't be set up.
+	defer func() {
+		if err != nil {
+			l.limiter.release()
+		}
+	}()
+
+	ctx := traceContext.Extract(l.cfg.ctx, propagation.MapCarrier(hello.Trace))
+	ctx, span := l.cfg.startSpan(ctx, "aznet.Accept", attrConnID.String(connID))
+	defer func() { endSpan(span, err) }()
+
+	// Replicas sharing the handshake endpoint all see this handshake;
+	// only the one holding the claim goes on to allocate a session.
+	hsID := hs.ID
+	claimer, _ := l.driver.(HandshakeClaimer)
+	if claimer != nil {
+		if hsID, err = claimer.ClaimHandshake(ctx, hs); err != nil {
+			return nil, err
+		}
+	}
+	// Until the token is posted, a failed accept hands the claim back rather
+	// than holding it until it lapses. Once it is posted, or the handshake is
+	// deleted, there is nothing left to hand back.
+	settled := false
+	defer func() {
+		if err == nil || settled || claimer == nil {
+			return
+		}
+		claimed := hs
+		claimed.ID = hsID
+		if rerr := claimer.ReleaseHandshake(l.cfg.ctx, claimed); rerr != nil {
+			l.cfg.logger.Warn("aznet: releasing handshake failed", "conn_id", connID, "handshake", hsID, "err", rerr)
+		}
+	}()
+	if h := l.cfg.hooks.OnHandshake; h != nil {
+		h(connID)
+	}
+
+	// Encapsulation is the costly part of the hybrid exchange, so it is
+	// spent only on a handshake that passed every check and is ours.
+	var kemCiphertext []byte
+	if l.cfg.hybridKEM {
+		if kemCiphertext, err = noise.encapsulate(hello.KEM); err != nil {
+			settled = true
+			return nil, l.quarantine(Handshake{ID: hsID}, err)
 		}
-		time.Sleep(l.cfg.acceptPoll)
 	}
+
+	// Generate tokens (driver specific tokens via Provider)
+	tokens, err := l.driver.CreateSession(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+	l.cfg.logger.Debug("aznet: session created", "conn_id", connID)
+	encodedTokens, err := json.Marshal(tokenPayload{SessionTokens: tokens, Window: l.cfg.receiveWindow})
+	if err != nil {
+		return nil, err
+	}
+
+	msg2, err := noise.WriteMessage(encodedTokens)
+	if err != nil {
+		return nil, err
+	}
+	if kemCiphertext != nil {
+		msg2 = append(kemCiphertext, msg2...)
+	}
+
+	if err := l.driver.PostToken(ctx, connID, msg2); err != nil {
+		return nil, err
+	}
+	// The client now holds a token, so the handshake can't be accepted again.
+	settled = true
+
+	if !noise.IsComplete() {
+		return nil, l.quarantine(Handshake{ID: hsID}, ErrHandshakeIncomplete)
+	}
+
+	// Inform Provider we are done and want a transport
+	transport, err := l.driver.NewTransport(ctx, connID, tokens, false)
+	if err != nil {
+		return nil, l.quarantine(Handshake{ID: hsID}, err)
+	}
+
+	if err := l.driver.DeleteHandshake(ctx, hsID); err != nil {
+		l.cfg.logger.Warn("aznet: deleting handshake failed", "conn_id", connID, "handshake", hsID, "err", err)
+	}
+	l.cfg.logger.Info("aznet: connection accepted", "conn_id", connID)
+	connCtx, cancel := context.WithCancel(l.cfg.ctx)
+	conn := newConn(connCtx, cancel, transport, l.cfg, noise, l.driver, connID)
+	conn.setupFlow(l.cfg.receiveWindow, 0)
+	l.conns.Store(connID, conn)
+	l.replays.add(connID, hello.stamp())
+	l.active.Add(1)
+	if h := l.cfg.hooks.OnAccept; h != nil {
+		h(conn)
+	}
+	return conn, nil
+}
+
+// idleWait sleeps until the next handshake scan, returning early if the
+// listener is closed.
+func (l *Listener) idleWait() {
+	d := l.poll.Next()
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-l.cfg.ctx.Done():
+	case <-l.stopAccept:
+	case <-t.C:
+	}
+}
+
+// releaseHandshakes hands back handshakes that were listed but will not be
+// accepted here.
+func (l *Listener) releaseHandshakes(handshakes []Handshake) {
+	claimer, ok := l.driver.(HandshakeClaimer)
+	if !ok {
+		return
+	}
+	for _, hs := range handshakes {
+		if err := claimer.ReleaseHandshake(l.cfg.ctx, hs); err != nil {
+			l.cfg.logger.Warn("aznet: releasing handshake failed", "handshake", hs.ID, "err", err)
+		}
+	}
+}
+
+// quarantine deletes a handshake that will never be accepted and counts it.
+// It returns err, the reason, for the caller to pass on.
+func (l *Listener) quarantine(hs Handshake, err error) error {
+	if derr := l.driver.DeleteHandshake(l.cfg.ctx, hs.ID); derr != nil {
+		l.cfg.logger.Warn("aznet: deleting handshake failed", "handshake", hs.ID, "err", derr)
+	}
+	if r, ok := l.cfg.metrics.(QuarantineRecorder); ok {
+		r.IncrementQuarantinedHandshakes()
+	}
+	return err
 }
 
 // ConnectionString returns the connection string for this listener.
@@ -915,16 +1694,82 @@ func (l *Listener) Close() error {
 	// Gracefully close all connections
 	l.conns.Range(func(key, value any) bool {
 		conn := value.(*Conn)
-		_ = conn.Close()
+		_ = conn.close(CloseListener)
 		return true
 	})
 
-	// Cleanup shared bootstrap endpoints
+	// Other replicas may still be serving the shared bootstrap endpoints, so
+	// they are only deleted when asked to.
+	if !l.cfg.cleanupEndpoints {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	return l.driver.CleanupBootstrap(ctx)
 }
 
+// Shutdown gracefully shuts down the listener without interrupting active
+// connections, in the manner of http.Server.Shutdown. It stops Accept, which
+// no longer polls the handshake endpoint and hands back what it had listed but
+// not accepted, so other replicas sharing the endpoint pick it up. It then
+// waits for each accepted connection to finish: closed by the application after
+// the peer's FIN was read. A connection closed before its peer's FIN arrived is
+// left to the janitor, which reaps it once the peer has been silent for the
+// idle timeout, so the peer gets to read what was sent last. Each finished
+// connection's session is cleaned up.
+//
+// The shared endpoints are left in place unless the listener was created with
+// WithEndpointCleanup. Then the handshake endpoint is deleted first, so new
+// dials fail fast, and the token endpoint last, once no dial can still be
+// waiting on it.
+//
+// If ctx expires first, Shutdown returns the context's error and the remaining
+// connections stay open; call Close to tear them down.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	if l.shuttingDown.CompareAndSwap(false, true) {
+		close(l.stopAccept)
+	}
+
+	var err error
+	if hc, ok := l.driver.(HandshakeEndpointCleaner); ok && l.cfg.cleanupEndpoints {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = hc.CleanupHandshakeEndpoint(cleanupCtx)
+		cancel()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		remaining := 0
+		l.conns.Range(func(key, value any) bool {
+			conn := value.(*Conn)
+			if conn.closed.Load() == 1 && conn.closedRead.Load() == 1 {
+				l.reap(key.(string), CloseLocal)
+			} else {
+				remaining++
+			}
+			return true
+		})
+		if remaining == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	l.cfg.cancel()
+	if !l.cfg.cleanupEndpoints {
+		return nil
+	}
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return errors.Join(err, l.driver.CleanupBootstrap(cleanupCtx))
+}
+
 func (l *Listener) Addr() net.Addr {
 	return ServiceAddr{l.network, l.ep.ServiceURL(), l.cfg.handshakeEndpoint}
 }
@@ -938,6 +1783,7 @@ func (l *Listener) janitor() {
 		case <-l.cfg.ctx.Done():
 			return
 		case <-ticker.C:
+			var live []string
 			l.conns.Range(func(key, value any) bool {
 				id := key.(string)
 				conn := value.(*Conn)
@@ -946,25 +1792,66 @@ func (l *Listener) janitor() {
 				closedRead := conn.closedRead.Load() == 1
 				peerLastSeen := time.Unix(0, conn.peerLastSeen.Load())
 
-				if (closed && closedRead) || time.Since(peerLastSeen) > l.cfg.idleTimeout {
-					_ = conn.Close()
-					// Final cleanup of driver resources
-					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-					_ = l.driver.DeleteToken(ctx, id)
-					_ = l.driver.CleanupSession(ctx, id)
-					cancel()
-					l.conns.Delete(id)
+				var reason CloseReason
+				switch {
+				case closed && closedRead:
+					reason = CloseLocal
+				case time.Since(peerLastSeen) > l.cfg.idleTimeout:
+					reason = ClosePeerIdle
+					conn.markPeerIdle()
+				default:
+					live = append(live, id)
+					return true
+				}
+				if l.reap(id, reason) {
+					if h := l.cfg.hooks.OnJanitorReap; h != nil {
+						h(id, reason)
+					}
 				}
 				return true
 			})
+			if l.cfg.sweepInterval > 0 {
+				l.touch(live, l.cfg.idleTimeout/2)
+			}
 		}
 	}
 }
 
+// reap closes the connection registered under id and removes its driver
+// resources. Only the caller that unregisters it does the cleanup, so the
+// janitor and Shutdown can race on the same connection safely. reason is
+// passed on to the OnClose hook if the connection is still open. It reports
+// whether this call did the reaping.
+func (l *Listener) reap(id string, reason CloseReason) bool {
+	v, ok := l.conns.LoadAndDelete(id)
+	if !ok {
+		return false
+	}
+	l.active.Add(-1)
+	l.cfg.logger.Info("aznet: reaping connection", "conn_id", id, "reason", string(reason))
+	_ = v.(*Conn).close(reason)
+
+	// Final cleanup of driver resources
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := l.driver.DeleteToken(ctx, id); err != nil {
+		l.cfg.logger.Debug("aznet: deleting token failed", "conn_id", id, "err", err)
+	}
+	if err := l.driver.CleanupSession(ctx, id); err != nil {
+		l.cfg.logger.Warn("aznet: session cleanup failed", "conn_id", id, "err", err)
+	}
+	return true
+}
+
 type metricsTransport struct {
 	Transport
-	rot Rotator // nil if underlying transport doesn't support rotation
+	rot Rotator       // nil if underlying transport doesn't support rotation
+	dbg DebugStater   // nil if underlying transport exposes no debug state
+	rec RawIORecorder // nil if metrics don't track latency
 	m   Metrics
+	own DefaultMetrics // this transport's traffic alone, for Conn.Info
+
+	release func() // set when m is a scope of ScopedMetrics
 }
 
 func newMetricsTransport(t Transport, m Metrics) *metricsTransport {
@@ -972,6 +1859,12 @@ func newMetricsTransport(t Transport, m Metrics) *metricsTransport {
 	if r, ok := t.(Rotator); ok {
 		mt.rot = r
 	}
+	if d, ok := t.(DebugStater); ok {
+		mt.dbg = d
+	}
+	if r, ok := m.(RawIORecorder); ok {
+		mt.rec = r
+	}
 	return mt
 }
 
@@ -983,23 +1876,56 @@ func (t *metricsTransport) WriteRaw(ctx context.Context, seq uint64, data io.Rea
 		_, _ = data.Seek(pos, io.SeekStart)
 		size = end - pos
 	}
+	start := time.Now()
 	err := t.Transport.WriteRaw(ctx, seq, data)
 	if err == nil {
 		t.m.IncrementWriteTransaction()
 		t.m.IncrementBytesSent(size)
+		t.own.IncrementWriteTransaction()
+		t.own.IncrementBytesSent(size)
+		if t.rec != nil {
+			t.rec.RecordWriteRaw(time.Since(start), size)
+		}
 	}
 	return err
 }
 
 func (t *metricsTransport) ReadRaw(ctx context.Context) (io.ReadCloser, error) {
+	start := time.Now()
 	rc, err := t.Transport.ReadRaw(ctx)
 	if err == nil {
 		t.m.IncrementReadTransaction()
-		return &metricsReadCloser{ReadCloser: rc, m: t.m}, nil
+		t.own.IncrementReadTransaction()
+		return &metricsReadCloser{ReadCloser: rc, m: t.m, own: &t.own, rec: t.rec, start: start}, nil
+	}
+	// An empty poll is billed like any other read.
+	if errors.Is(err, ErrNoData) {
+		t.m.IncrementReadTransaction()
+		t.own.IncrementReadTransaction()
+		if t.rec != nil {
+			t.rec.RecordReadRaw(time.Since(start), 0)
+		}
 	}
 	return nil, err
 }
 
+func (t *metricsTransport) connStats() *DefaultMetrics { return &t.own }
+
+func (t *metricsTransport) DebugState() map[string]any {
+	if t.dbg != nil {
+		return t.dbg.DebugState()
+	}
+	return nil
+}
+
+func (t *metricsTransport) Close() error {
+	err := t.Transport.Close()
+	if t.release != nil {
+		t.release()
+	}
+	return err
+}
+
 func (t *metricsTransport) ShouldRotate() bool {
 	if t.rot != nil {
 		return t.rot.ShouldRotate()
@@ -1023,13 +1949,28 @@ func (t *metricsTransport) RotateRX() error {
 
 type metricsReadCloser struct {
 	io.ReadCloser
-	m Metrics
+	m     Metrics
+	own   *DefaultMetrics
+	rec   RawIORecorder // nil if metrics don't track latency
+	start time.Time     // when ReadRaw was called
+	n     int64
 }
 
 func (r *metricsReadCloser) Read(p []byte) (int, error) {
 	n, err := r.ReadCloser.Read(p)
 	if n > 0 {
 		r.m.IncrementBytesReceived(int64(n))
+		r.own.IncrementBytesReceived(int64(n))
+		r.n += int64(n)
 	}
 	return n, err
 }
+
+// Close reports the chunk as a whole, so the latency covers the download.
+func (r *metricsReadCloser) Close() error {
+	if r.rec != nil {
+		r.rec.RecordReadRaw(time.Since(r.start), r.n)
+		r.rec = nil
+	}
+	return r.ReadCloser.Close()
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue/queueerror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue/sas"
+	"github.com/google/uuid"
 )
 
 const queueDriverName = "azqueue"
@@ -36,6 +37,8 @@ const (
 	// maxPendingMessages caps the reassembly buffer's memory footprint. Liveness
 	// is not tied to it: the stall clock in ReadRaw fails a missing sequence.
 	maxPendingMessages = 256
+	// maxQueueRawSize is the largest sealed chunk that fits in one message.
+	maxQueueRawSize = (MaxQueueTextMessageSize*3)/4 - seqHeaderSize - queueSizeMargin
 	// defaultReassemblyStall bounds the wait for a missing sequence when the
 	// config carries no usable idle timeout.
 	defaultReassemblyStall = 60 * time.Second
@@ -114,25 +117,75 @@ type queueDriver struct {
 }
 
 func (p *queueDriver) PostHandshake(ctx context.Context, connID string, msg []byte) error {
-	_, err := p.handshakeQueue.EnqueueMessage(ctx, base64.StdEncoding.EncodeToString(msg), nil)
+	// The bootstrap SAS can't withdraw a message, so it expires once the
+	// dialer has given up waiting instead.
+	ttl := max(int32(p.cfg.connectTimeout/time.Second), 1)
+	_, err := p.handshakeQueue.EnqueueMessage(ctx, base64.StdEncoding.EncodeToString(msg),
+		&azqueue.EnqueueMessageOptions{TimeToLive: &ttl})
 	return err
 }
 
 func (p *queueDriver) GetHandshakes(ctx context.Context) ([]Handshake, error) {
-	resp, err := p.handshakeQueue.DequeueMessages(ctx, &azqueue.DequeueMessagesOptions{NumberOfMessages: to.Ptr[int32](32), VisibilityTimeout: to.Ptr[int32](60)})
+	resp, err := p.handshakeQueue.DequeueMessages(ctx, &azqueue.DequeueMessagesOptions{NumberOfMessages: to.Ptr[int32](32), VisibilityTimeout: to.Ptr(int32(handshakeClaimTTL / time.Second))})
 	if err != nil {
 		return nil, err
 	}
 	var handshakes []Handshake
 	for _, msg := range resp.Messages {
+		if msg.MessageID == nil || msg.PopReceipt == nil {
+			continue
+		}
+		// Unreadable messages get a nil Payload, so the listener deletes them.
+		hs := Handshake{ID: *msg.MessageID + ":" + *msg.PopReceipt}
+		if msg.InsertionTime != nil {
+			hs.Created = *msg.InsertionTime
+		}
 		if msg.MessageText != nil {
-			data, _ := base64.StdEncoding.DecodeString(*msg.MessageText)
-			handshakes = append(handshakes, Handshake{ID: *msg.MessageID + ":" + *msg.PopReceipt, Payload: data})
+			hs.Payload, _ = base64.StdEncoding.DecodeString(*msg.MessageText)
 		}
+		handshakes = append(handshakes, hs)
 	}
 	return handshakes, nil
 }
 
+// ClaimHandshake renews the dequeue visibility timeout. Dequeuing already hides
+// the message from other replicas, but only until the timeout lapses; once it
+// has, another replica may have dequeued it and our pop receipt is stale, which
+// the update reports as not found or mismatched.
+func (p *queueDriver) ClaimHandshake(ctx context.Context, hs Handshake) (string, error) {
+	parts := strings.Split(hs.ID, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid handshake id format")
+	}
+	resp, err := p.handshakeQueue.UpdateMessage(ctx, parts[0], parts[1], base64.StdEncoding.EncodeToString(hs.Payload),
+		&azqueue.UpdateMessageOptions{VisibilityTimeout: to.Ptr(int32(handshakeClaimTTL / time.Second))})
+	if err != nil {
+		if queueerror.HasCode(err, queueerror.MessageNotFound, queueerror.PopReceiptMismatch) {
+			return "", ErrHandshakeClaimed
+		}
+		return "", err
+	}
+	if resp.PopReceipt == nil {
+		return hs.ID, nil
+	}
+	return parts[0] + ":" + *resp.PopReceipt, nil
+}
+
+// ReleaseHandshake makes the message visible again right away. The update
+// replaces the message text, so it writes back the original payload.
+func (p *queueDriver) ReleaseHandshake(ctx context.Context, hs Handshake) error {
+	parts := strings.Split(hs.ID, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid handshake id format")
+	}
+	_, err := p.handshakeQueue.UpdateMessage(ctx, parts[0], parts[1], base64.StdEncoding.EncodeToString(hs.Payload),
+		&azqueue.UpdateMessageOptions{VisibilityTimeout: to.Ptr(int32(0))})
+	if queueerror.HasCode(err, queueerror.MessageNotFound, queueerror.PopReceiptMismatch) {
+		return nil
+	}
+	return err
+}
+
 func (p *queueDriver) DeleteHandshake(ctx context.Context, id string) error {
 	parts := strings.Split(id, ":")
 	if len(parts) != 2 {
@@ -204,7 +257,8 @@ func (p *queueDriver) CreateBootstrapTokens() (string, string, error) {
 
 func (p *queueDriver) CreateSession(ctx context.Context, connID string) (SessionTokens, error) {
 	reqName, resName := p.cfg.reqPrefix+"-"+connID, p.cfg.resPrefix+"-"+connID
-	if _, err := p.client.CreateQueue(ctx, reqName, nil); err != nil && !queueerror.HasCode(err, queueerror.QueueAlreadyExists) {
+	// The request queue carries the session's activity stamp for sweepers.
+	if _, err := p.client.CreateQueue(ctx, reqName, &azqueue.CreateOptions{Metadata: activityMetadata(time.Now())}); err != nil && !queueerror.HasCode(err, queueerror.QueueAlreadyExists) {
 		return SessionTokens{}, fmt.Errorf("create session queue %s: %w", reqName, err)
 	}
 	if _, err := p.client.CreateQueue(ctx, resName, nil); err != nil && !queueerror.HasCode(err, queueerror.QueueAlreadyExists) {
@@ -223,6 +277,7 @@ func (p *queueDriver) CreateSession(ctx context.Context, connID string) (Session
 
 func (p *queueDriver) NewTransport(_ context.Context, connID string, tokens SessionTokens, isInitiator bool) (Transport, error) {
 	reqName, resName := p.cfg.reqPrefix+"-"+connID, p.cfg.resPrefix+"-"+connID
+	txName, rxName := reqName, resName
 	var tx, rx *azqueue.QueueClient
 	if isInitiator {
 		var err error
@@ -235,9 +290,10 @@ func (p *queueDriver) NewTransport(_ context.Context, connID string, tokens Sess
 			return nil, fmt.Errorf("%w: %v", ErrClientCreationFailed, err)
 		}
 	} else {
-		tx, rx = p.client.NewQueueClient(resName), p.client.NewQueueClient(reqName)
+		txName, rxName = resName, reqName
+		tx, rx = p.client.NewQueueClient(txName), p.client.NewQueueClient(rxName)
 	}
-	return &queueTransport{connID: connID, txQueue: tx, rxQueue: rx, ep: p.ep, txName: reqName, rxName: resName, cfg: p.cfg, pending: make(map[uint64][]byte)}, nil
+	return &queueTransport{connID: connID, txQueue: tx, rxQueue: rx, ep: p.ep, txName: txName, rxName: rxName, cfg: p.cfg, pending: make(map[uint64][]byte)}, nil
 }
 
 func (p *queueDriver) CleanupBootstrap(ctx context.Context) error {
@@ -249,6 +305,16 @@ func (p *queueDriver) CleanupBootstrap(ctx context.Context) error {
 	return nil
 }
 
+// CleanupHandshakeEndpoint removes the handshake endpoint, leaving the token
+// endpoint in place.
+func (p *queueDriver) CleanupHandshakeEndpoint(ctx context.Context) error {
+	if p.client == nil {
+		return nil
+	}
+	_, _ = p.client.NewQueueClient(p.cfg.handshakeEndpoint).Delete(ctx, nil)
+	return nil
+}
+
 func (p *queueDriver) CleanupSession(ctx context.Context, connID string) error {
 	if p.client == nil {
 		return nil
@@ -258,6 +324,55 @@ func (p *queueDriver) CleanupSession(ctx context.Context, connID string) error {
 	return nil
 }
 
+// TouchSession stamps the request queue's metadata.
+func (p *queueDriver) TouchSession(ctx context.Context, connID string) error {
+	if p.client == nil {
+		return nil
+	}
+	_, err := p.client.NewQueueClient(p.cfg.reqPrefix+"-"+connID).SetMetadata(ctx, &azqueue.SetMetadataOptions{Metadata: activityMetadata(time.Now())})
+	return err
+}
+
+// ListSessions finds sessions by their request queues, whose names are the
+// request prefix followed by the connID.
+func (p *queueDriver) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	if p.client == nil {
+		return nil, nil
+	}
+	prefix := p.cfg.reqPrefix + "-"
+	pager := p.client.NewListQueuesPager(&azqueue.ListQueuesOptions{
+		Prefix:  &prefix,
+		Include: azqueue.ListQueuesInclude{Metadata: true},
+	})
+	var sessions []SessionInfo
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range resp.Queues {
+			if q.Name == nil {
+				continue
+			}
+			connID := strings.TrimPrefix(*q.Name, prefix)
+			// uuid.Parse also takes the undashed form, which is not a
+			// queue we named.
+			if id, err := uuid.Parse(connID); err != nil || id.String() != connID {
+				continue
+			}
+			last, ok := parseActivity(q.Metadata)
+			if !ok {
+				if err := p.TouchSession(ctx, connID); err != nil {
+					continue
+				}
+				last = time.Now()
+			}
+			sessions = append(sessions, SessionInfo{ConnID: connID, LastActive: last})
+		}
+	}
+	return sessions, nil
+}
+
 type queueTransport struct {
 	txQueue, rxQueue *azqueue.QueueClient
 	ep               *Endpoint
@@ -285,6 +400,32 @@ type queueTransport struct {
 	rxSeq uint64 // next contiguous sequence expected
 }
 
+// DebugState reports the reassembly state. It waits for rmu, which is never
+// held across a round-trip.
+func (t *queueTransport) DebugState() map[string]any {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	s := map[string]any{
+		"txQueue": t.txName,
+		"rxQueue": t.rxName,
+		"rxSeq":   t.rxSeq,
+		"pending": len(t.pending),
+	}
+	if !t.stallSince.IsZero() {
+		s["stallSince"] = t.stallSince
+	}
+	if t.rxErr != nil {
+		s["rxErr"] = t.rxErr.Error()
+	}
+	return s
+}
+
+// MaxReceiveWindow keeps a full window of maximum-size chunks within half the
+// reassembly buffer, leaving the rest for duplicates and control chunks.
+func (p *queueDriver) MaxReceiveWindow() int64 {
+	return maxPendingMessages / 2 * maxQueueRawSize
+}
+
 // encodeQueueMessage prepends the big-endian sequence to raw and base64-encodes
 // the result for transport in a single queue message.
 func encodeQueueMessage(seq uint64, raw []byte) string {
@@ -445,14 +586,12 @@ func (t *queueTransport) Close() error { return nil }
 
 // MaxRawSize reserves room for the sequence header and a safety margin so the
 // base64-encoded message stays under the 64 KiB queue ceiling.
-func (t *queueTransport) MaxRawSize() int {
-	return (MaxQueueTextMessageSize*3)/4 - seqHeaderSize - queueSizeMargin
-}
+func (t *queueTransport) MaxRawSize() int { return maxQueueRawSize }
 func (t *queueTransport) LocalAddr() net.Addr {
-	return ServiceAddr{queueDriverName, t.ep.ServiceURL(), t.txName}
+	return ServiceAddr{queueDriverName, t.ep.ServiceURL(), t.rxName}
 }
 func (t *queueTransport) RemoteAddr() net.Addr {
-	return ServiceAddr{queueDriverName, t.ep.ServiceURL(), t.rxName}
+	return ServiceAddr{queueDriverName, t.ep.ServiceURL(), t.txName}
 }
 
 func newQueueClient(ep *Endpoint) (*azqueue.ServiceClient, error) {
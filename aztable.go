@@ -12,10 +12,12 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
 )
 
 const tableDriverName = "aztable"
@@ -54,7 +56,8 @@ func extractTableData(raw []byte) []byte {
 		if !ok {
 			break
 		}
-		chunk, _ := base64.StdEncoding.DecodeString(v.(string))
+		encoded, _ := v.(string) // tolerate malformed entities
+		chunk, _ := base64.StdEncoding.DecodeString(encoded)
 		res = append(res, chunk...)
 	}
 	return res
@@ -62,6 +65,10 @@ func extractTableData(raw []byte) []byte {
 
 type tableFactory struct{}
 
+// ServiceSeparator joins service names without a dash: table names are
+// alphanumeric.
+func (d *tableFactory) ServiceSeparator() string { return "" }
+
 func (d *tableFactory) NewDriver(ep *Endpoint, cfg *Config) (Driver, error) {
 	client, err := newTableClient(ep)
 	if err != nil {
@@ -91,6 +98,7 @@ func (d *tableFactory) NewDriver(ep *Endpoint, cfg *Config) (Driver, error) {
 		cfg:            cfg,
 		handshakeTable: ht,
 		tokenTable:     tt,
+		instanceID:     uuid.New().String(),
 	}, nil
 }
 
@@ -110,11 +118,23 @@ type tableDriver struct {
 	client                     *aztables.ServiceClient
 	cfg                        *Config
 	handshakeTable, tokenTable *aztables.Client
+	instanceID                 string   // claim owner written into handshake entities
+	posted                     sync.Map // connID → ETag of a handshake entity this dialer posted
 }
 
 func (p *tableDriver) PostHandshake(ctx context.Context, connID string, msg []byte) error {
 	data, _ := buildTableEntity(p.cfg.handshakeEndpoint, connID, msg)
-	_, err := p.handshakeTable.AddEntity(ctx, data, nil)
+	resp, err := p.handshakeTable.AddEntity(ctx, data, nil)
+	if err == nil {
+		// Kept so that CancelHandshake only replaces the entity as posted.
+		p.posted.Store(connID, resp.ETag)
+		return nil
+	}
+	// connID is fresh, so a conflict means a retried post already landed; its
+	// ETag is lost, and with it the chance to cancel.
+	if re, ok := err.(*azcore.ResponseError); ok && re.StatusCode == http.StatusConflict {
+		return nil
+	}
 	return err
 }
 
@@ -127,14 +147,99 @@ func (p *tableDriver) GetHandshakes(ctx context.Context) ([]Handshake, error) {
 			return nil, err
 		}
 		for _, e := range resp.Entities {
-			var meta struct{ RowKey string }
+			var meta struct {
+				RowKey    string
+				Timestamp time.Time
+			}
 			json.Unmarshal(e, &meta)
-			handshakes = append(handshakes, Handshake{ID: meta.RowKey, Payload: extractTableData(e)})
+			handshakes = append(handshakes, Handshake{ID: meta.RowKey, Payload: extractTableData(e), Created: meta.Timestamp})
 		}
 	}
 	return handshakes, nil
 }
 
+// CancelHandshake replaces the handshake entity this driver posted with an
+// empty one, using the bootstrap SAS's update permission. The replace is
+// conditional on the ETag the post returned, so it fails with
+// ErrHandshakeClaimed once a listener has claimed or deleted the entity, like
+// the blob driver's lease does. The SAS has no read permission, so nobody can
+// learn the ETag of another dialer's handshake to cancel it. Connection
+// strings issued before the update permission was added can't cancel, and fail
+// with 403.
+func (p *tableDriver) CancelHandshake(ctx context.Context, connID string) error {
+	v, ok := p.posted.LoadAndDelete(connID)
+	if !ok {
+		return fmt.Errorf("no ETag for handshake %s", connID)
+	}
+	etag := v.(azcore.ETag)
+	entity, _ := json.Marshal(map[string]any{"PartitionKey": p.cfg.handshakeEndpoint, "RowKey": connID})
+	_, err := p.handshakeTable.UpdateEntity(ctx, entity, &aztables.UpdateEntityOptions{IfMatch: &etag, UpdateMode: aztables.UpdateModeReplace})
+	if re, ok := err.(*azcore.ResponseError); ok && (re.StatusCode == http.StatusPreconditionFailed || re.StatusCode == http.StatusNotFound) {
+		return ErrHandshakeClaimed
+	}
+	return err
+}
+
+// ClaimHandshake stamps the handshake entity with this instance as owner, using
+// the entity's ETag so that of two replicas racing, only the first update lands
+// and the other gets a 412. A claim older than handshakeClaimTTL is abandoned
+// and may be taken over.
+func (p *tableDriver) ClaimHandshake(ctx context.Context, hs Handshake) (string, error) {
+	resp, err := p.handshakeTable.GetEntity(ctx, p.cfg.handshakeEndpoint, hs.ID, nil)
+	if err != nil {
+		if re, ok := err.(*azcore.ResponseError); ok && re.StatusCode == http.StatusNotFound {
+			return "", ErrHandshakeClaimed
+		}
+		return "", err
+	}
+	var claim struct {
+		ClaimedBy string
+		ClaimedAt time.Time
+	}
+	_ = json.Unmarshal(resp.Value, &claim)
+	if claim.ClaimedBy != "" && claim.ClaimedBy != p.instanceID && time.Since(claim.ClaimedAt) < handshakeClaimTTL {
+		return "", ErrHandshakeClaimed
+	}
+
+	entity, _ := json.Marshal(map[string]any{
+		"PartitionKey": p.cfg.handshakeEndpoint, "RowKey": hs.ID,
+		"ClaimedBy": p.instanceID, "ClaimedAt": time.Now().UTC(), "ClaimedAt@odata.type": "Edm.DateTime",
+	})
+	_, err = p.handshakeTable.UpdateEntity(ctx, entity, &aztables.UpdateEntityOptions{IfMatch: &resp.ETag, UpdateMode: aztables.UpdateModeMerge})
+	if err != nil {
+		if re, ok := err.(*azcore.ResponseError); ok && (re.StatusCode == http.StatusPreconditionFailed || re.StatusCode == http.StatusNotFound) {
+			return "", ErrHandshakeClaimed
+		}
+		return "", err
+	}
+	return hs.ID, nil
+}
+
+// ReleaseHandshake clears our stamp from the handshake entity. The update is
+// conditional on the ETag read, so a claim another replica took over after
+// ours lapsed is left alone.
+func (p *tableDriver) ReleaseHandshake(ctx context.Context, hs Handshake) error {
+	resp, err := p.handshakeTable.GetEntity(ctx, p.cfg.handshakeEndpoint, hs.ID, nil)
+	if err != nil {
+		if re, ok := err.(*azcore.ResponseError); ok && re.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	var claim struct{ ClaimedBy string }
+	_ = json.Unmarshal(resp.Value, &claim)
+	if claim.ClaimedBy != p.instanceID {
+		return nil
+	}
+
+	entity, _ := json.Marshal(map[string]any{"PartitionKey": p.cfg.handshakeEndpoint, "RowKey": hs.ID, "ClaimedBy": ""})
+	_, err = p.handshakeTable.UpdateEntity(ctx, entity, &aztables.UpdateEntityOptions{IfMatch: &resp.ETag, UpdateMode: aztables.UpdateModeMerge})
+	if re, ok := err.(*azcore.ResponseError); ok && (re.StatusCode == http.StatusPreconditionFailed || re.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
 func (p *tableDriver) DeleteHandshake(ctx context.Context, id string) error {
 	_, err := p.handshakeTable.DeleteEntity(ctx, p.cfg.handshakeEndpoint, id, nil)
 	return err
@@ -149,7 +254,8 @@ func (p *tableDriver) PostToken(ctx context.Context, connID string, msg []byte)
 func (p *tableDriver) GetToken(ctx context.Context, connID string) ([]byte, error) {
 	resp, err := p.tokenTable.GetEntity(ctx, p.cfg.tokenEndpoint, connID, nil)
 	if err != nil {
-		if re, ok := err.(*azcore.ResponseError); ok && re.StatusCode == http.StatusNotFound {
+		// A missing table, unlike a missing entity, means the listener is gone.
+		if re, ok := err.(*azcore.ResponseError); ok && re.StatusCode == http.StatusNotFound && re.ErrorCode != string(aztables.TableNotFound) {
 			return nil, ErrNoData
 		}
 		return nil, err
@@ -180,7 +286,7 @@ func (p *tableDriver) CreateBootstrapTokens() (string, string, error) {
 	if p.ep.Account == "" || p.ep.Key == "" {
 		return "", "", ErrSASGenerationFailed
 	}
-	hSAS, err := p.makeSAS(p.cfg.handshakeEndpoint, aztables.SASPermissions{Add: true})
+	hSAS, err := p.makeSAS(p.cfg.handshakeEndpoint, aztables.SASPermissions{Add: true, Update: true})
 	if err != nil {
 		return "", "", fmt.Errorf("%w: %v", ErrSASGenerationFailed, err)
 	}
@@ -197,6 +303,9 @@ func (p *tableDriver) CreateSession(ctx context.Context, connID string) (Session
 	if _, err := p.client.CreateTable(ctx, name, nil); err != nil {
 		return SessionTokens{}, fmt.Errorf("create session table %s: %w", name, err)
 	}
+	if err := p.TouchSession(ctx, connID); err != nil {
+		return SessionTokens{}, fmt.Errorf("stamp session table %s: %w", name, err)
+	}
 	if _, err := p.client.CreateTable(ctx, resName, nil); err != nil {
 		return SessionTokens{}, fmt.Errorf("create session table %s: %w", resName, err)
 	}
@@ -214,6 +323,7 @@ func (p *tableDriver) CreateSession(ctx context.Context, connID string) (Session
 func (p *tableDriver) NewTransport(_ context.Context, connID string, tokens SessionTokens, isInitiator bool) (Transport, error) {
 	sid := strings.ReplaceAll(connID, "-", "")
 	reqName, resName := p.cfg.reqPrefix+sid, p.cfg.resPrefix+sid
+	txName, rxName := reqName, resName
 	var tx, rx *aztables.Client
 	if isInitiator {
 		var err error
@@ -226,9 +336,10 @@ func (p *tableDriver) NewTransport(_ context.Context, connID string, tokens Sess
 			return nil, fmt.Errorf("%w: %v", ErrClientCreationFailed, err)
 		}
 	} else {
-		tx, rx = p.client.NewClient(resName), p.client.NewClient(reqName)
+		txName, rxName = resName, reqName
+		tx, rx = p.client.NewClient(txName), p.client.NewClient(rxName)
 	}
-	return &tableTransport{connID: connID, txClient: tx, rxClient: rx, ep: p.ep, txName: reqName, rxName: resName, cfg: p.cfg}, nil
+	return &tableTransport{connID: connID, txClient: tx, rxClient: rx, ep: p.ep, txName: txName, rxName: rxName, cfg: p.cfg}, nil
 }
 
 func (p *tableDriver) CleanupBootstrap(ctx context.Context) error {
@@ -240,6 +351,16 @@ func (p *tableDriver) CleanupBootstrap(ctx context.Context) error {
 	return nil
 }
 
+// CleanupHandshakeEndpoint removes the handshake endpoint, leaving the token
+// endpoint in place.
+func (p *tableDriver) CleanupHandshakeEndpoint(ctx context.Context) error {
+	if p.client == nil {
+		return nil
+	}
+	_, _ = p.client.DeleteTable(ctx, p.cfg.handshakeEndpoint, nil)
+	return nil
+}
+
 func (p *tableDriver) CleanupSession(ctx context.Context, connID string) error {
 	if p.client == nil {
 		return nil
@@ -250,6 +371,69 @@ func (p *tableDriver) CleanupSession(ctx context.Context, connID string) error {
 	return nil
 }
 
+// Tables carry no metadata, so a session's activity stamp lives in an entity of
+// its request table, outside the "data" partition the transport reads.
+const (
+	sessionActivityPartition = "session"
+	sessionActivityRow       = "activity"
+)
+
+// TouchSession upserts the activity entity in the request table.
+func (p *tableDriver) TouchSession(ctx context.Context, connID string) error {
+	if p.client == nil {
+		return nil
+	}
+	entity, _ := json.Marshal(map[string]any{
+		"PartitionKey": sessionActivityPartition, "RowKey": sessionActivityRow,
+		"ConnID": connID, "LastActive": time.Now().UTC(), "LastActive@odata.type": "Edm.DateTime",
+	})
+	name := p.cfg.reqPrefix + strings.ReplaceAll(connID, "-", "")
+	_, err := p.client.NewClient(name).UpsertEntity(ctx, entity, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace})
+	return err
+}
+
+// ListSessions finds sessions by their request tables, named the request
+// prefix followed by the dashless connID, and reads each one's activity entity.
+func (p *tableDriver) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	if p.client == nil {
+		return nil, nil
+	}
+	// Table names compare as strings; "{" sorts right after "z", bounding the prefix.
+	filter := "TableName ge '" + p.cfg.reqPrefix + "' and TableName lt '" + p.cfg.reqPrefix + "{'"
+	pager := p.client.NewListTablesPager(&aztables.ListTablesOptions{Filter: &filter})
+	var sessions []SessionInfo
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Tables {
+			if t.Name == nil {
+				continue
+			}
+			id, err := uuid.Parse(strings.TrimPrefix(*t.Name, p.cfg.reqPrefix))
+			if err != nil {
+				continue
+			}
+			connID := id.String()
+
+			var activity struct{ LastActive time.Time }
+			e, err := p.client.NewClient(*t.Name).GetEntity(ctx, sessionActivityPartition, sessionActivityRow, nil)
+			if err == nil {
+				_ = json.Unmarshal(e.Value, &activity)
+			}
+			if activity.LastActive.IsZero() {
+				if err := p.TouchSession(ctx, connID); err != nil {
+					continue
+				}
+				activity.LastActive = time.Now()
+			}
+			sessions = append(sessions, SessionInfo{ConnID: connID, LastActive: activity.LastActive})
+		}
+	}
+	return sessions, nil
+}
+
 type tableTransport struct {
 	txClient, rxClient *aztables.Client
 	ep                 *Endpoint
@@ -303,13 +487,24 @@ func (t *tableTransport) ReadRaw(ctx context.Context) (io.ReadCloser, error) {
 	return nil, ErrNoData
 }
 
+// DebugState reports the tables in use and the next row expected.
+func (t *tableTransport) DebugState() map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return map[string]any{
+		"txTable": t.txName,
+		"rxTable": t.rxName,
+		"rxSeq":   t.rxSeq,
+	}
+}
+
 func (t *tableTransport) Close() error    { return nil }
 func (t *tableTransport) MaxRawSize() int { return MaxTableEntitySize }
 func (t *tableTransport) LocalAddr() net.Addr {
-	return ServiceAddr{tableDriverName, t.ep.ServiceURL(), t.txName}
+	return ServiceAddr{tableDriverName, t.ep.ServiceURL(), t.rxName}
 }
 func (t *tableTransport) RemoteAddr() net.Addr {
-	return ServiceAddr{tableDriverName, t.ep.ServiceURL(), t.rxName}
+	return ServiceAddr{tableDriverName, t.ep.ServiceURL(), t.txName}
 }
 
 func formatRowKey(seq int) string {
@@ -0,0 +1,67 @@
+package aznet
+
+import "sync/atomic"
+
+const (
+	// MinChunkSize is the smallest sealed chunk size WithMaxChunkSize and
+	// WithAdaptiveChunkSize accept; smaller values are raised to it.
+	MinChunkSize = 4 << 10
+
+	// DefaultMinChunkSize is where adaptive chunk sizing starts, and the size it
+	// shrinks back to for interactive traffic.
+	DefaultMinChunkSize = 64 << 10
+)
+
+// chunkSizer picks the size of the next sealed chunk. Fixed sizing always
+// targets max. Adaptive sizing starts at min, doubles while writes leave a
+// backlog behind each chunk (sustained throughput, where fewer, larger chunks
+// save transactions) and halves when a flush sends one small chunk with
+// nothing behind it (interactive traffic, where small chunks reach the peer
+// sooner).
+type chunkSizer struct {
+	min, max int
+	adaptive bool
+	cur      atomic.Int64
+}
+
+// newChunkSizer returns a sizer for a transport whose chunks may be at most
+// maxRaw bytes, honouring the configured cap and adaptive floor.
+func newChunkSizer(cfg *Config, maxRaw int) *chunkSizer {
+	s := &chunkSizer{max: maxRaw, adaptive: cfg.adaptiveChunk}
+	if cfg.maxChunkSize > 0 {
+		s.max = min(s.max, max(cfg.maxChunkSize, MinChunkSize))
+	}
+	s.min = s.max
+	if s.adaptive {
+		s.min = min(s.max, max(cfg.minChunkSize, MinChunkSize))
+	}
+	s.cur.Store(int64(s.min))
+	return s
+}
+
+// target returns the current sealed chunk size.
+func (s *chunkSizer) target() int {
+	return int(s.cur.Load())
+}
+
+// frameSize returns the largest data payload that keeps one frame within the
+// current chunk size.
+func (s *chunkSizer) frameSize() int {
+	return s.target() - NoiseOverhead - FrameHeaderSize
+}
+
+// observe adapts the target after a chunk carrying n plaintext bytes was
+// sealed; backlog reports whether more frames were queued behind it. Caller
+// must hold fmu.
+func (s *chunkSizer) observe(n int, backlog bool) {
+	if !s.adaptive {
+		return
+	}
+	cur := s.target()
+	switch {
+	case backlog && cur < s.max:
+		s.cur.Store(int64(min(cur*2, s.max)))
+	case !backlog && n < cur/4 && cur > s.min:
+		s.cur.Store(int64(max(cur/2, s.min)))
+	}
+}
@@ -0,0 +1,71 @@
+package aznet
+
+import "testing"
+
+func TestNewChunkSizer(t *testing.T) {
+	const maxRaw = 4 << 20
+	tests := []struct {
+		name             string
+		cfg              Config
+		wantMin, wantMax int
+	}{
+		{"transport limit", Config{}, maxRaw, maxRaw},
+		{"capped", Config{maxChunkSize: 1 << 20}, 1 << 20, 1 << 20},
+		{"cap above transport limit", Config{maxChunkSize: 8 << 20}, maxRaw, maxRaw},
+		{"cap raised to minimum", Config{maxChunkSize: 100}, MinChunkSize, MinChunkSize},
+		{"adaptive", Config{adaptiveChunk: true, minChunkSize: DefaultMinChunkSize}, DefaultMinChunkSize, maxRaw},
+		{"adaptive floor raised to minimum", Config{adaptiveChunk: true, minChunkSize: 1}, MinChunkSize, maxRaw},
+		{"adaptive floor above cap", Config{adaptiveChunk: true, minChunkSize: 2 << 20, maxChunkSize: 1 << 20}, 1 << 20, 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newChunkSizer(&tt.cfg, maxRaw)
+			if s.min != tt.wantMin || s.max != tt.wantMax {
+				t.Errorf("min, max = %d, %d; want %d, %d", s.min, s.max, tt.wantMin, tt.wantMax)
+			}
+			if s.target() != tt.wantMin {
+				t.Errorf("target() = %d, want %d", s.target(), tt.wantMin)
+			}
+			if s.frameSize() != s.target()-NoiseOverhead-FrameHeaderSize {
+				t.Errorf("frameSize() = %d, want target minus overheads", s.frameSize())
+			}
+		})
+	}
+}
+
+func TestChunkSizerObserve(t *testing.T) {
+	const lo, hi = 64 << 10, 512 << 10
+	type obs struct {
+		n       int
+		backlog bool
+	}
+	tests := []struct {
+		name     string
+		adaptive bool
+		start    int
+		observe  []obs
+		want     int
+	}{
+		{"fixed ignores traffic", false, hi, []obs{{10, false}, {10, false}}, hi},
+		{"backlog doubles", true, lo, []obs{{lo, true}}, 2 * lo},
+		{"backlog stops at hi", true, lo, []obs{{0, true}, {0, true}, {0, true}, {0, true}}, hi},
+		{"small chunk halves", true, 4 * lo, []obs{{100, false}}, 2 * lo},
+		{"small chunk stops at lo", true, 2 * lo, []obs{{100, false}, {100, false}}, lo},
+		{"large chunk without backlog holds", true, 4 * lo, []obs{{2 * lo, false}}, 4 * lo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &chunkSizer{min: lo, max: hi, adaptive: tt.adaptive}
+			if !tt.adaptive {
+				s.min = hi
+			}
+			s.cur.Store(int64(tt.start))
+			for _, o := range tt.observe {
+				s.observe(o.n, o.backlog)
+			}
+			if got := s.target(); got != tt.want {
+				t.Errorf("target() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
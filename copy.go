@@ -0,0 +1,211 @@
+package aznet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// ReadFrom implements io.ReaderFrom, so io.Copy into a Conn reads straight into
+// a Data frame sized to the current chunk and seals it as a chunk of its own,
+// bypassing the write buffer. Each chunk takes a single Read from r. Errors
+// from r are returned as-is; others are *OpError.
+func (c *Conn) ReadFrom(r io.Reader) (int64, error) {
+	var (
+		n     int64
+		frame []byte
+	)
+	for {
+		if err := c.writable(); err != nil {
+			return n, c.opError("write", err)
+		}
+
+		c.wmu.Lock()
+		if c.bufs == nil {
+			c.wmu.Unlock()
+			return n, c.opError("write", io.ErrClosedPipe)
+		}
+		size := min(c.chunks.frameSize(), c.flow.allowance())
+		limit := c.flow.sent
+		// Reserve the window now, so a concurrent Write cannot spend it
+		// while r.Read runs.
+		c.flow.sent += int64(size)
+		c.wmu.Unlock()
+
+		if size <= 0 {
+			if err := c.waitWindow(limit); err != nil {
+				return n, c.opError("write", err)
+			}
+			continue
+		}
+
+		if cap(frame) < FrameHeaderSize+size {
+			frame = make([]byte, FrameHeaderSize+size)
+		}
+		frame = frame[:FrameHeaderSize+size]
+
+		m, rerr := r.Read(frame[FrameHeaderSize:])
+		if m < size {
+			c.wmu.Lock()
+			c.flow.sent -= int64(size - m)
+			c.wmu.Unlock()
+		}
+		if m > 0 {
+			binary.BigEndian.PutUint32(frame[:4], uint32(m))
+			frame[4] = MsgTypeData
+			if err := c.sendFrame(frame[:FrameHeaderSize+m], m == size); err != nil {
+				return n, c.opError("write", err)
+			}
+			n += int64(m)
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// sendFrame sends frame, a complete Data frame built outside the write buffer,
+// as a chunk of its own after everything queued before it. full reports that
+// the caller had more to send, for adaptive chunk sizing. The caller has
+// already counted the payload in flow.sent.
+func (c *Conn) sendFrame(frame []byte, full bool) error {
+	c.fmu.Lock()
+	defer c.fmu.Unlock()
+
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	if c.rotator != nil && c.rotator.ShouldRotate() {
+		if err := c.sendRotate(); err != nil {
+			return err
+		}
+	}
+
+	sealed, err := c.noise.SealData(c.bufs.Enc, frame)
+	if err != nil {
+		return err
+	}
+	c.bufs.Enc = sealed[:0]
+	c.chunks.observe(len(frame), full)
+
+	if err := c.sendChunk(sealed, 0, false, c.chunkSeq); err != nil {
+		return err
+	}
+	c.chunkSent()
+	return nil
+}
+
+// WriteTo implements io.WriterTo, so io.Copy out of a Conn hands decrypted
+// payloads to w straight from the read buffer. The buffer is swapped for a
+// spare before writing, so a slow w holds up neither fetches nor Close. It
+// returns nil at the peer's FIN. Errors from w are returned as-is; others are
+// *OpError.
+func (c *Conn) WriteTo(w io.Writer) (int64, error) {
+	var (
+		n     int64
+		spare bytes.Buffer
+	)
+	for {
+		if c.closed.Load() == 1 {
+			return n, c.opError("read", net.ErrClosed)
+		}
+
+		c.rmu.Lock()
+		if err := c.readable(); err != nil {
+			c.rmu.Unlock()
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, c.opError("read", err)
+		}
+		if c.bufs.Read.Len() == 0 {
+			c.rmu.Unlock()
+			if err := c.awaitData(); err != nil {
+				return n, c.opError("read", err)
+			}
+			continue
+		}
+
+		spare.Reset()
+		c.bufs.Read, spare = spare, c.bufs.Read
+		remain := c.readRemain
+		c.readRemain = 0
+		c.peerLastSeen.Store(time.Now().UnixNano())
+		c.rmu.Unlock()
+
+		m, fin, left, leftRemain, err := writeFrames(w, spare.Bytes(), remain)
+		n += int64(m)
+		c.consume(m)
+		if err != nil {
+			c.unread(left, leftRemain)
+			return n, err
+		}
+		if fin {
+			c.closedRead.Store(1)
+			return n, nil
+		}
+	}
+}
+
+// unread puts back what WriteTo took from the read buffer but w did not take,
+// ahead of anything fetched since, so a later Read picks up where w failed.
+// The first remain bytes of left are the rest of a payload.
+func (c *Conn) unread(left []byte, remain int) {
+	if len(left) == 0 {
+		return
+	}
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if c.bufs == nil {
+		return
+	}
+	var b bytes.Buffer
+	b.Grow(len(left) + c.bufs.Read.Len())
+	b.Write(left)
+	b.Write(c.bufs.Read.Bytes())
+	c.bufs.Read = b
+	c.readRemain = remain
+}
+
+// writeFrames writes the Data payloads in buf to w, stopping at a FIN frame.
+// The first remain bytes of buf are the rest of a payload Read already started.
+// buf holds only whole frames, as ingest guarantees for the read buffer. If w
+// fails, left is the part of buf not written, in the same form: its first
+// leftRemain bytes are the rest of the payload w failed in.
+func writeFrames(w io.Writer, buf []byte, remain int) (n int, fin bool, left []byte, leftRemain int, err error) {
+	if remain > 0 {
+		m, err := w.Write(buf[:remain])
+		n += m
+		if err != nil {
+			return n, false, buf[m:], remain - m, err
+		}
+		buf = buf[remain:]
+	}
+	for len(buf) >= FrameHeaderSize {
+		frame := buf
+		fType := buf[4]
+		fLen := int(binary.BigEndian.Uint32(buf[:4]))
+		payload := buf[FrameHeaderSize : FrameHeaderSize+fLen]
+		buf = buf[FrameHeaderSize+fLen:]
+
+		switch fType {
+		case MsgTypeData:
+			if fLen == 0 {
+				continue
+			}
+			m, err := w.Write(payload)
+			n += m
+			if err != nil {
+				return n, false, frame[FrameHeaderSize+m:], fLen - m, err
+			}
+		case MsgTypeFin:
+			return n, true, nil, 0, nil
+		}
+	}
+	return n, false, nil, 0, nil
+}
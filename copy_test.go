@@ -0,0 +1,73 @@
+package aznet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// shortWriter takes up to room bytes, then fails.
+type shortWriter struct {
+	bytes.Buffer
+	room int
+}
+
+var errShortWrite = errors.New("short write")
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.room {
+		w.room -= len(p)
+		return w.Buffer.Write(p)
+	}
+	n, _ := w.Buffer.Write(p[:w.room])
+	w.room = 0
+	return n, errShortWrite
+}
+
+func TestWriteFramesLeavesUnwrittenRemainder(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("xy") // rest of a payload Read already started
+	BuildFrame(&buf, Frame{Type: MsgTypeData, Payload: []byte("hello")})
+	BuildFrame(&buf, Frame{Type: MsgTypePing, Payload: nil})
+	BuildFrame(&buf, Frame{Type: MsgTypeData, Payload: []byte("world")})
+	const all = "xyhelloworld"
+
+	for room := 0; room <= len(all); room++ {
+		w := &shortWriter{room: room}
+		n, fin, left, leftRemain, err := writeFrames(w, buf.Bytes(), 2)
+		if fin {
+			t.Fatalf("room %d: fin without a FIN frame", room)
+		}
+		if room == len(all) {
+			if err != nil || n != len(all) {
+				t.Fatalf("room %d: writeFrames() = %d, %v, want %d, nil", room, n, err, len(all))
+			}
+			continue
+		}
+		if !errors.Is(err, errShortWrite) || n != room {
+			t.Fatalf("room %d: writeFrames() = %d, %v, want %d, errShortWrite", room, n, err, room)
+		}
+
+		// Delivering left afterwards must yield exactly the rest.
+		rest := &shortWriter{room: len(all)}
+		if _, _, _, _, err := writeFrames(rest, left, leftRemain); err != nil {
+			t.Fatalf("room %d: writing left: %v", room, err)
+		}
+		if got := w.String() + rest.String(); got != all {
+			t.Errorf("room %d: delivered %q, want %q", room, got, all)
+		}
+	}
+}
+
+func TestWriteFramesStopsAtFin(t *testing.T) {
+	var buf bytes.Buffer
+	BuildFrame(&buf, Frame{Type: MsgTypeData, Payload: []byte("a")})
+	BuildFrame(&buf, Frame{Type: MsgTypeFin})
+	BuildFrame(&buf, Frame{Type: MsgTypeData, Payload: []byte("b")})
+
+	var w bytes.Buffer
+	n, fin, _, _, err := writeFrames(&w, buf.Bytes(), 0)
+	if err != nil || !fin || n != 1 || w.String() != "a" {
+		t.Errorf("writeFrames() = %d, %v, %v, wrote %q; want 1, true, nil, \"a\"", n, fin, err, w.String())
+	}
+}
@@ -0,0 +1,73 @@
+package aznet
+
+import (
+	"sync"
+	"time"
+)
+
+// Pricing converts Metrics counters into money for one driver, in whatever
+// currency the prices are given in. Transaction prices are per 10,000
+// operations, the unit Azure publishes them in.
+type Pricing struct {
+	Write  float64 // per 10,000 write transactions
+	Read   float64 // per 10,000 read transactions
+	List   float64 // per 10,000 list transactions
+	Delete float64 // per 10,000 delete transactions
+	Egress float64 // per GB received; zero when the peer runs in-region
+}
+
+// DefaultPricing returns EUR list prices for the driver's default tier (hot LRS
+// for blobs, LRS for queues and tables), as in the pricing reference of the
+// docs. Prices vary by region and tier and change over time; pass your own
+// through WithPricing for anything beyond a rough estimate.
+func DefaultPricing(driver string) Pricing {
+	switch driver {
+	case blobDriverName:
+		return Pricing{Write: 0.0655, Read: 0.0051, List: 0.0655}
+	case queueDriverName:
+		return Pricing{Write: 0.0004, Read: 0.0004, List: 0.0004, Delete: 0.0004}
+	case tableDriverName:
+		return Pricing{Write: 0.0266, Read: 0.0054, List: 0.0952}
+	}
+	return Pricing{}
+}
+
+// Cost estimates what the operations counted by m have cost.
+func (p Pricing) Cost(m Metrics) float64 {
+	return (float64(m.GetWriteTransactionCount())*p.Write+
+		float64(m.GetReadTransactionCount())*p.Read+
+		float64(m.GetListTransactionCount())*p.List+
+		float64(m.GetDeleteTransactionCount())*p.Delete)/10_000 +
+		float64(m.GetBytesReceived())/1e9*p.Egress
+}
+
+// overBudgetPollFactor stretches the steady poll interval while the cost
+// budget is exhausted.
+const overBudgetPollFactor = 10
+
+// costBudget tracks spend against a budget over fixed periods. Safe for
+// concurrent use.
+type costBudget struct {
+	amount float64
+	period time.Duration
+
+	mu    sync.Mutex
+	start time.Time // start of the current period
+	base  float64   // cost already spent when the period started
+}
+
+// exceeded reports whether the cost counted by m since the start of the
+// current period has reached the budget.
+func (b *costBudget) exceeded(m Metrics, p Pricing) bool {
+	if b == nil {
+		return false
+	}
+	cost := p.Cost(m)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now := time.Now(); b.start.IsZero() || now.Sub(b.start) >= b.period {
+		b.start, b.base = now, cost
+	}
+	return cost-b.base >= b.amount
+}
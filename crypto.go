@@ -1,21 +1,73 @@
 package aznet
 
 import (
+	"crypto/mlkem"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/flynn/noise"
 )
 
-// NoiseOverhead is the encryption overhead: 4 bytes length prefix + 16 bytes AES-GCM tag.
+// NoiseOverhead is the encryption overhead: 4 bytes length prefix + 16 bytes
+// AEAD tag. Both supported ciphers use 16-byte tags.
 const NoiseOverhead = 4 + 16
 
-// defaultCipherSuite is the Noise cipher suite used for all connections.
-// Cached at package level since it's immutable and reusable.
+// CipherSuite names the Noise cipher and hash functions of a connection as
+// "<cipher>_<hash>", the way they appear in a Noise protocol name. Key
+// agreement is always Curve25519. Both sides must use the same suite; a
+// listener puts a non-default suite in its connection string so dialers pick
+// it up.
+type CipherSuite string
+
+const (
+	// CipherSuiteAESGCMSHA256 is the default, fastest where AES is accelerated
+	// in hardware.
+	CipherSuiteAESGCMSHA256 CipherSuite = "AESGCM_SHA256"
+	// CipherSuiteChaChaPolyBLAKE2s suits devices without AES acceleration.
+	CipherSuiteChaChaPolyBLAKE2s CipherSuite = "ChaChaPoly_BLAKE2s"
+	// CipherSuiteChaChaPolyBLAKE2b prefers 64-bit platforms.
+	CipherSuiteChaChaPolyBLAKE2b CipherSuite = "ChaChaPoly_BLAKE2b"
+	// CipherSuiteChaChaPolySHA256 pairs ChaCha20-Poly1305 with SHA-256.
+	CipherSuiteChaChaPolySHA256 CipherSuite = "ChaChaPoly_SHA256"
+)
+
+var (
+	noiseCiphers = map[string]noise.CipherFunc{
+		"AESGCM":     noise.CipherAESGCM,
+		"ChaChaPoly": noise.CipherChaChaPoly,
+	}
+	noiseHashes = map[string]noise.HashFunc{
+		"SHA256":  noise.HashSHA256,
+		"SHA512":  noise.HashSHA512,
+		"BLAKE2s": noise.HashBLAKE2s,
+		"BLAKE2b": noise.HashBLAKE2b,
+	}
+)
+
+// defaultCipherSuite is the Noise cipher suite used unless WithCipherSuite
+// says otherwise. Cached at package level since it's immutable and reusable.
 var defaultCipherSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherAESGCM, noise.HashSHA256)
 
+// noiseSuite resolves s, with the empty suite meaning the default.
+func (s CipherSuite) noiseSuite() (noise.CipherSuite, error) {
+	if s == "" || s == CipherSuiteAESGCMSHA256 {
+		return defaultCipherSuite, nil
+	}
+	cipherName, hashName, _ := strings.Cut(string(s), "_")
+	cipher, ok := noiseCiphers[cipherName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCipherSuite, s)
+	}
+	hash, ok := noiseHashes[hashName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCipherSuite, s)
+	}
+	return noise.NewCipherSuite(noise.DH25519, cipher, hash), nil
+}
+
 var (
 	// ErrHandshakeFailed is returned when the Noise handshake fails.
 	ErrHandshakeFailed = errors.New("handshake failed")
@@ -32,6 +84,15 @@ var (
 	// ErrChunkTooLarge is returned when a sealed chunk declares a length larger
 	// than the transport can produce, which means the stream is corrupt.
 	ErrChunkTooLarge = errors.New("sealed chunk exceeds transport maximum")
+	// ErrUnsupportedCipherSuite is returned for a cipher suite name that is not
+	// a supported cipher and hash pair.
+	ErrUnsupportedCipherSuite = errors.New("unsupported cipher suite")
+	// ErrCipherSuiteMismatch is returned when the peers are set up with
+	// different cipher suites.
+	ErrCipherSuiteMismatch = errors.New("cipher suite mismatch")
+	// ErrKeyExchangeMismatch is returned when only one peer is set up for the
+	// hybrid post-quantum key exchange.
+	ErrKeyExchangeMismatch = errors.New("hybrid key exchange mismatch")
 )
 
 // Noise encapsulates the Noise Protocol handshake state and cipher suite.
@@ -46,29 +107,87 @@ type Noise struct {
 // NewNoiseClient creates a new Noise Protocol handshake as the initiator (client).
 // It uses the NN pattern (no static keys, anonymous connection).
 func NewNoiseClient() (*Noise, error) {
-	hs, err := noise.NewHandshakeState(noise.Config{
-		CipherSuite: defaultCipherSuite,
-		Pattern:     noise.HandshakeNN,
-		Initiator:   true,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrNoiseInitFailed, err)
-	}
-	return &Noise{hs: hs, isInitiator: true}, nil
+	return newNoise(defaultCipherSuite, true, false)
 }
 
 // NewNoiseServer creates a new Noise Protocol handshake as the responder (server).
 // It uses the NN pattern (no static keys, anonymous connection).
 func NewNoiseServer() (*Noise, error) {
-	hs, err := noise.NewHandshakeState(noise.Config{
-		CipherSuite: defaultCipherSuite,
+	return newNoise(defaultCipherSuite, false, false)
+}
+
+// newNoise creates an NN handshake over the given cipher suite. With psk2 the
+// pattern is NNpsk2, whose second message mixes in a key that is only known
+// once message 1 has been exchanged; see SetPresharedKey.
+func newNoise(suite noise.CipherSuite, initiator, psk2 bool) (*Noise, error) {
+	cfg := noise.Config{
+		CipherSuite: suite,
 		Pattern:     noise.HandshakeNN,
-		Initiator:   false,
-	})
+		Initiator:   initiator,
+	}
+	if psk2 {
+		cfg.PresharedKeyPlacement = 2
+	}
+	hs, err := noise.NewHandshakeState(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrNoiseInitFailed, err)
 	}
-	return &Noise{hs: hs, isInitiator: false}, nil
+	return &Noise{hs: hs, isInitiator: initiator}, nil
+}
+
+// SetPresharedKey sets the 32-byte key of an NNpsk2 handshake. It must be
+// called before message 2 is written or read.
+func (nh *Noise) SetPresharedKey(psk []byte) error {
+	return nh.hs.SetPresharedKey(psk)
+}
+
+// The hybrid key exchange runs ML-KEM-768 alongside the handshake: the client
+// sends a fresh encapsulation key in its hello, the listener encapsulates to it
+// and prepends the ciphertext to message 2, and both use the shared secret as
+// the NNpsk2 preshared key. Session keys then depend on both X25519 and
+// ML-KEM, so recorded traffic stays confidential unless both are broken.
+const (
+	kemParam    = "kem"      // connection URL parameter enabling the hybrid exchange
+	kemMLKEM768 = "mlkem768" // its only value
+)
+
+// newKEMKey returns a fresh decapsulation key for a client hello.
+func newKEMKey() (*mlkem.DecapsulationKey768, error) {
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoiseInitFailed, err)
+	}
+	return dk, nil
+}
+
+// encapsulate derives the preshared key from the client's encapsulation key and
+// returns the ciphertext to send ahead of message 2.
+func (nh *Noise) encapsulate(ek []byte) ([]byte, error) {
+	key, err := mlkem.NewEncapsulationKey768(ek)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	shared, ciphertext := key.Encapsulate()
+	if err := nh.SetPresharedKey(shared); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	return ciphertext, nil
+}
+
+// decapsulate derives the preshared key from the ciphertext at the start of
+// token and returns the rest, message 2.
+func (nh *Noise) decapsulate(dk *mlkem.DecapsulationKey768, token []byte) ([]byte, error) {
+	if len(token) < mlkem.CiphertextSize768 {
+		return nil, fmt.Errorf("%w: token too short for ML-KEM ciphertext", ErrHandshakeFailed)
+	}
+	shared, err := dk.Decapsulate(token[:mlkem.CiphertextSize768])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	if err := nh.SetPresharedKey(shared); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	return token[mlkem.CiphertextSize768:], nil
 }
 
 // WriteMessage creates the next handshake message, encrypting the payload.
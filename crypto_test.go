@@ -0,0 +1,131 @@
+package aznet
+
+import (
+	"bytes"
+	"crypto/mlkem"
+	"testing"
+)
+
+// handshake runs message 1 and 2 between a fresh dialer and listener, with the
+// hybrid key exchange if kem is set. dialerKey, if not nil, replaces the key
+// the dialer decapsulates with.
+func handshake(t *testing.T, suite CipherSuite, kem bool, dialerKey *mlkem.DecapsulationKey768) (dialer, listener *Noise, err error) {
+	t.Helper()
+	ns, err := suite.noiseSuite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialer, err = newNoise(ns, true, kem); err != nil {
+		t.Fatal(err)
+	}
+	if listener, err = newNoise(ns, false, kem); err != nil {
+		t.Fatal(err)
+	}
+
+	var dk *mlkem.DecapsulationKey768
+	hello := handshakeHello{ID: "abc"}
+	if kem {
+		if dk, err = newKEMKey(); err != nil {
+			t.Fatal(err)
+		}
+		hello.KEM = dk.EncapsulationKey().Bytes()
+	}
+	payload, _ := hello.marshal()
+	msg1, err := dialer.WriteMessage(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := listener.ReadMessage(msg1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseHandshakeHello(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ciphertext []byte
+	if kem {
+		if ciphertext, err = listener.encapsulate(parsed.KEM); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg2, err := listener.WriteMessage([]byte("tokens"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := append(ciphertext, msg2...)
+
+	if kem {
+		if dialerKey != nil {
+			dk = dialerKey
+		}
+		if token, err = dialer.decapsulate(dk, token); err != nil {
+			return dialer, listener, err
+		}
+	}
+	reply, err := dialer.ReadMessage(token)
+	if err != nil {
+		return dialer, listener, err
+	}
+	if string(reply) != "tokens" {
+		t.Fatalf("reply = %q, want %q", reply, "tokens")
+	}
+	return dialer, listener, nil
+}
+
+func TestNoiseRoundTrip(t *testing.T) {
+	suites := []CipherSuite{
+		CipherSuiteAESGCMSHA256,
+		CipherSuiteChaChaPolyBLAKE2s,
+		CipherSuiteChaChaPolyBLAKE2b,
+		CipherSuiteChaChaPolySHA256,
+	}
+	for _, suite := range suites {
+		for _, kem := range []bool{false, true} {
+			name := string(suite)
+			if kem {
+				name += "/hybrid"
+			}
+			t.Run(name, func(t *testing.T) {
+				dialer, listener, err := handshake(t, suite, kem, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !dialer.IsComplete() || !listener.IsComplete() {
+					t.Fatal("handshake incomplete")
+				}
+
+				for _, dir := range []struct {
+					name     string
+					from, to *Noise
+				}{{"dialer to listener", dialer, listener}, {"listener to dialer", listener, dialer}} {
+					data := []byte("payload from the " + dir.name)
+					sealed, err := dir.from.SealData(nil, data)
+					if err != nil {
+						t.Fatalf("%s: SealData: %v", dir.name, err)
+					}
+					plain, rest, err := dir.to.UnsealData(nil, sealed, 0)
+					if err != nil {
+						t.Fatalf("%s: UnsealData: %v", dir.name, err)
+					}
+					if !bytes.Equal(plain, data) || len(rest) != 0 {
+						t.Errorf("%s: unsealed %q with %d bytes left, want %q", dir.name, plain, len(rest), data)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNoiseHybridWrongKey(t *testing.T) {
+	other, err := newKEMKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ML-KEM decapsulation never fails outright; the mismatch surfaces as a
+	// preshared key that does not match the listener's.
+	if _, _, err := handshake(t, CipherSuiteAESGCMSHA256, true, other); err == nil {
+		t.Fatal("handshake with the wrong decapsulation key succeeded")
+	}
+}
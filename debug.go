@@ -0,0 +1,124 @@
+package aznet
+
+import "time"
+
+// DebugStater is optionally implemented by transports to expose their internal
+// state, e.g. reassembly or rotation progress, for troubleshooting. The map is
+// rendered as-is by the debug package; values should marshal to JSON.
+type DebugStater interface {
+	DebugState() map[string]any
+}
+
+// ConnDebugState is a snapshot of a connection's internals, for
+// troubleshooting. Fields guarded by a lock that is held across a storage call
+// are left zero rather than waiting for it, and Flushing says so.
+type ConnDebugState struct {
+	ConnInfo
+
+	ReadBuffered       int // decrypted bytes not yet returned by Read
+	ReadRemain         int // bytes left of the data frame being read
+	WriteBuffered      int // frames queued but not yet sent
+	CiphertextBuffered int // fetched bytes not yet decrypted
+
+	Flushing     bool   // a flush is in progress; the fields below are unknown
+	ChunkSeq     uint64 // sequence number of the next chunk to send
+	PendingChunk bool   // a sealed chunk awaits a write retry
+	PendingSeq   uint64
+	ChunkSize    int // current target size of a sealed chunk
+
+	// Flow control; SendWindow is -1 when sending is not flow controlled.
+	SendWindow int64 // data bytes the peer accepts right now
+	Consumed   int64 // data bytes read by the application
+	Advertised int64 // receive limit last advertised to the peer
+
+	PollInterval time.Duration // current back-off, if the poll strategy reports it
+	TxRotations  int64
+	RxRotations  int64
+	RTT          RTTStats
+
+	Transport map[string]any `json:",omitempty"` // from DebugStater
+}
+
+// ListenerDebugState is a snapshot of a listener's internals.
+type ListenerDebugState struct {
+	Network      string
+	Addr         string
+	Active       int64
+	MaxConns     int
+	ShuttingDown bool
+	OverBudget   bool
+	PollInterval time.Duration // current back-off between handshake scans
+	Conns        []ConnDebugState
+}
+
+// pollReporter is implemented by the built-in poll strategies.
+type pollReporter interface {
+	Current() time.Duration
+}
+
+// DebugState returns a snapshot of the connection's internals. It never waits
+// on a storage call.
+func (c *Conn) DebugState() ConnDebugState {
+	s := ConnDebugState{
+		ConnInfo:    c.Info(),
+		TxRotations: c.txRotations.Load(),
+		RxRotations: c.rxRotations.Load(),
+		RTT:         c.RTT(),
+		ChunkSize:   c.chunks.target(),
+	}
+	if p, ok := c.poll.(pollReporter); ok {
+		s.PollInterval = p.Current()
+	}
+	if d, ok := c.transport.(DebugStater); ok {
+		s.Transport = d.DebugState()
+	}
+
+	// fmu is held across WriteRaw, so only peek. Lock order: fmu → wmu → rmu.
+	if c.fmu.TryLock() {
+		s.ChunkSeq = c.chunkSeq
+		s.PendingChunk = c.pending.valid
+		s.PendingSeq = c.pending.seq
+		defer c.fmu.Unlock()
+	} else {
+		s.Flushing = true
+	}
+	c.wmu.Lock()
+	if c.bufs != nil {
+		s.WriteBuffered = c.bufs.Write.Len()
+	}
+	s.SendWindow = -1
+	if c.flow.limited.Load() {
+		s.SendWindow = int64(c.flow.allowance())
+	}
+	c.wmu.Unlock()
+	s.Consumed = c.flow.consumed.Load()
+	s.Advertised = c.flow.advertised.Load()
+	c.rmu.Lock()
+	if c.bufs != nil {
+		s.ReadBuffered = c.bufs.Read.Len()
+		s.CiphertextBuffered = c.bufs.Noise.Len()
+	}
+	s.ReadRemain = c.readRemain
+	c.rmu.Unlock()
+	return s
+}
+
+// DebugState returns a snapshot of the listener and its connections.
+func (l *Listener) DebugState() ListenerDebugState {
+	s := ListenerDebugState{
+		Network:      l.network,
+		Addr:         l.Addr().String(),
+		Active:       l.active.Load(),
+		MaxConns:     l.cfg.maxConns,
+		ShuttingDown: l.shuttingDown.Load(),
+		OverBudget:   l.cfg.overBudget(),
+	}
+	if p, ok := l.poll.(pollReporter); ok {
+		s.PollInterval = p.Current()
+	}
+	l.conns.Range(func(_, value any) bool {
+		s.Conns = append(s.Conns, value.(*Conn).DebugState())
+		return true
+	})
+	return s
+}
@@ -0,0 +1,53 @@
+// Package debug serves the internal state of aznet listeners and connections
+// over HTTP, for troubleshooting stuck connections in production.
+//
+// The handlers expose connection IDs and addresses. Mount them on an admin
+// port, not next to the application's public routes:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/aznet", debug.Handler(l))
+//	go http.ListenAndServe("localhost:6060", mux)
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/atsika/aznet"
+)
+
+// Handler serves the listener's state as JSON. With a conn query parameter it
+// serves only that connection, or 404 if the listener has no such connection.
+// Durations are in nanoseconds.
+func Handler(l *aznet.Listener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := l.DebugState()
+		id := r.URL.Query().Get("conn")
+		if id == "" {
+			writeJSON(w, state)
+			return
+		}
+		for _, c := range state.Conns {
+			if c.ID == id {
+				writeJSON(w, c)
+				return
+			}
+		}
+		http.Error(w, "connection not found", http.StatusNotFound)
+	})
+}
+
+// ConnHandler serves the state of a single connection as JSON, e.g. for a
+// dialed connection.
+func ConnHandler(c *aznet.Conn) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.DebugState())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
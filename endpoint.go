@@ -97,7 +97,7 @@ func (e *Endpoint) BuildConnURL(cfg *Config, handshakeSAS, tokenSAS string) stri
 		u.Path = "/" + e.Account
 	}
 
-	q := u.Query()
+	q := cfg.urlParams()
 	q.Set(cfg.handshakeEndpoint, handshakeEncoded)
 	q.Set(cfg.tokenEndpoint, tokenEncoded)
 	u.RawQuery = q.Encode()
@@ -0,0 +1,129 @@
+package aznet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// Storage error classes. Errors returned by Conn.Read and Conn.Write match one
+// of these with errors.Is when the underlying storage call failed for that
+// reason; errors.As still finds the original *azcore.ResponseError.
+var (
+	// ErrAuthExpired means the SAS token of the session has expired (see
+	// WithSASExpiry). Reconnecting issues fresh tokens.
+	ErrAuthExpired = errors.New("storage authorization expired")
+	// ErrThrottled means the storage account rejected the request as too busy
+	// (429 or 503), even after retries.
+	ErrThrottled = errors.New("storage throttled")
+	// ErrNotFound means the session's storage is gone, typically because the
+	// peer or a sweeper deleted it.
+	ErrNotFound = errors.New("storage resource not found")
+	// ErrPermissionDenied means the credentials lack a permission the
+	// operation needs.
+	ErrPermissionDenied = errors.New("storage permission denied")
+)
+
+// OpError is the error type returned by Conn.Read and Conn.Write, in the manner
+// of net.OpError. It implements net.Error.
+type OpError struct {
+	Op       string // "read" or "write"
+	Net      string // driver name, e.g. "azblob"
+	ConnID   string
+	Resource string // storage resource the operation used
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	s := e.Op + " " + e.Net
+	if e.Resource != "" {
+		s += " " + e.Resource
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the operation ran into a deadline, including the
+// peer idle timeout and storage request timeouts.
+func (e *OpError) Timeout() bool {
+	if errors.Is(e.Err, os.ErrDeadlineExceeded) || errors.Is(e.Err, context.DeadlineExceeded) ||
+		errors.Is(e.Err, ErrPeerTimeout) {
+		return true
+	}
+	var re *azcore.ResponseError
+	return errors.As(e.Err, &re) && re.StatusCode == http.StatusRequestTimeout
+}
+
+// Temporary reports whether retrying the operation later may succeed.
+//
+// Deprecated: as with net.Error, Temporary is ill-defined; use Timeout and
+// errors.Is with ErrThrottled instead.
+func (e *OpError) Temporary() bool {
+	return e.Timeout() || errors.Is(e.Err, ErrThrottled)
+}
+
+var _ net.Error = (*OpError)(nil)
+
+// storageError attaches a class sentinel to a storage error.
+type storageError struct {
+	class error
+	err   error
+}
+
+func (e *storageError) Error() string   { return e.err.Error() }
+func (e *storageError) Unwrap() []error { return []error{e.class, e.err} }
+
+// classifyStorageError wraps err with the matching storage error class, if any.
+func classifyStorageError(err error) error {
+	var re *azcore.ResponseError
+	if !errors.As(err, &re) {
+		return err
+	}
+	var class error
+	switch re.StatusCode {
+	case http.StatusForbidden:
+		// An expired SAS fails authentication with a complaint about its
+		// validity window; anything else is a missing permission.
+		msg := strings.ToLower(err.Error())
+		if re.ErrorCode == "AuthenticationFailed" && (strings.Contains(msg, "expir") || strings.Contains(msg, "time frame")) {
+			class = ErrAuthExpired
+		} else {
+			class = ErrPermissionDenied
+		}
+	case http.StatusNotFound:
+		class = ErrNotFound
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		class = ErrThrottled
+	default:
+		return err
+	}
+	return &storageError{class: class, err: err}
+}
+
+// opError wraps an error from Read or Write. io.EOF is returned as is, since
+// callers compare it with ==.
+func (c *Conn) opError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var addr net.Addr
+	if op == "read" {
+		addr = c.LocalAddr()
+	} else {
+		addr = c.RemoteAddr()
+	}
+	return &OpError{
+		Op:       op,
+		Net:      addr.Network(),
+		ConnID:   c.id,
+		Resource: addr.String(),
+		Err:      classifyStorageError(err),
+	}
+}
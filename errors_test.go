@@ -0,0 +1,42 @@
+package aznet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestClassifyStorageError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error // nil: returned unclassified
+	}{
+		{"not found", &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "ContainerNotFound"}, ErrNotFound},
+		{"throttled 429", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, ErrThrottled},
+		{"server busy", &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServerBusy"}, ErrThrottled},
+		{"permission denied", &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthorizationPermissionMismatch"}, ErrPermissionDenied},
+		{"internal error", &azcore.ResponseError{StatusCode: http.StatusInternalServerError}, nil},
+		{"not a storage error", errors.New("plain"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyStorageError(tt.err)
+			if tt.want == nil {
+				if got != tt.err {
+					t.Fatalf("classifyStorageError() = %v, want it unchanged", got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("classifyStorageError() = %v, want errors.Is %v", got, tt.want)
+			}
+			var re *azcore.ResponseError
+			if !errors.As(got, &re) {
+				t.Errorf("classifyStorageError() lost the *azcore.ResponseError")
+			}
+		})
+	}
+}
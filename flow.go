@@ -0,0 +1,193 @@
+package aznet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// windowPayloadSize is the size of a Window frame's payload: the cumulative
+// number of data bytes the receiver accepts, big-endian.
+const windowPayloadSize = 8
+
+// ReceiveWindowLimiter is optionally implemented by drivers whose transport
+// cannot buffer an arbitrary amount of unread data, e.g. because the receiver
+// must hold out-of-order chunks in memory. The receive window is capped at
+// MaxReceiveWindow bytes.
+type ReceiveWindowLimiter interface {
+	MaxReceiveWindow() int64
+}
+
+// flowControl is a connection's credit-based flow control. Each side has a
+// receive window; the sender may have at most that many data bytes outstanding
+// beyond what the receiver's application has read, and the receiver raises the
+// limit with Window frames as it reads. Only Data frame payloads count.
+//
+// The listener's window travels in its handshake reply. A dialer that got one
+// sends its own window in a Window frame ahead of any data, and the listener
+// turns flow control on when that frame arrives. Both directions are thus
+// controlled only if both peers have a window, so older peers are unaffected.
+type flowControl struct {
+	// Receiving side; window is zero while flow control is off.
+	window     atomic.Int64
+	offer      int64        // our window, taken on by enable
+	consumed   atomic.Int64 // data bytes returned by Read
+	advertised atomic.Int64 // limit last sent to the peer
+
+	// Sending side.
+	limited atomic.Bool
+	limit   atomic.Int64  // cumulative data bytes the peer accepts
+	sent    int64         // data bytes queued; guarded by Conn.wmu
+	raised  chan struct{} // buffered(1) signal that limit grew; nil if we have no window
+}
+
+// setupFlow prepares flow control with our window, and enables it at once if
+// the peer's window is known (peer > 0). It must run before the connection is
+// handed out.
+func (c *Conn) setupFlow(ours, peer int64) {
+	if ours <= 0 {
+		return
+	}
+	c.flow.offer = ours
+	c.flow.raised = make(chan struct{}, 1)
+	if peer > 0 {
+		c.flow.enable(peer)
+	}
+}
+
+// enable turns flow control on in both directions, with limit as what the peer
+// accepts so far.
+func (f *flowControl) enable(limit int64) {
+	f.advertised.Store(f.offer)
+	f.window.Store(f.offer)
+	f.limit.Store(limit)
+	f.limited.Store(true)
+}
+
+// allowance returns how many more data bytes may be queued. Caller must hold
+// wmu.
+func (f *flowControl) allowance() int {
+	if !f.limited.Load() {
+		return math.MaxInt
+	}
+	return int(max(f.limit.Load()-f.sent, 0))
+}
+
+// raiseLimit applies a Window frame. The first one from a peer we don't limit
+// yet enables flow control. Limits only grow, so a stale or reordered update is
+// harmless. Caller must hold rmu.
+func (f *flowControl) raiseLimit(limit int64) {
+	if f.raised == nil {
+		return
+	}
+	if !f.limited.Load() {
+		f.enable(limit) // no Write waits on a limit that did not apply
+		return
+	}
+	for {
+		cur := f.limit.Load()
+		if limit <= cur {
+			return
+		}
+		if f.limit.CompareAndSwap(cur, limit) {
+			break
+		}
+	}
+	select {
+	case f.raised <- struct{}{}:
+	default:
+	}
+}
+
+// consume records n data bytes handed to the application and, once half the
+// window has been read since the last update, advertises a new limit.
+func (c *Conn) consume(n int) {
+	w := c.flow.window.Load()
+	if w == 0 || n == 0 {
+		return
+	}
+	next := c.flow.consumed.Add(int64(n)) + w
+	prev := c.flow.advertised.Load()
+	if next-prev < w/2 || !c.flow.advertised.CompareAndSwap(prev, next) {
+		return
+	}
+	c.sendWindow(next)
+}
+
+// sendWindow queues a Window frame and flushes it in the background, like
+// sendPong. Updates still go out after CloseWrite: the peer may be writing.
+func (c *Conn) sendWindow(limit int64) {
+	if c.closed.Load() == 1 {
+		return
+	}
+	var payload [windowPayloadSize]byte
+	binary.BigEndian.PutUint64(payload[:], uint64(limit))
+	c.wmu.Lock()
+	if c.bufs == nil {
+		c.wmu.Unlock()
+		return
+	}
+	BuildFrame(&c.bufs.Write, Frame{Type: MsgTypeWindow, Payload: payload[:]})
+	c.wmu.Unlock()
+	go func() { _ = c.flush() }()
+}
+
+// waitWindow blocks a Write until the peer allows more than sent data bytes.
+// Window updates arrive on the read path, so it fetches them itself rather than
+// depend on the application reading; what it fetches is left for Read.
+func (c *Conn) waitWindow(sent int64) error {
+	for c.flow.limit.Load() <= sent {
+		if c.closed.Load() == 1 {
+			return net.ErrClosed
+		}
+		if c.peerTimedOut.Load() == 1 {
+			return ErrPeerTimeout
+		}
+		wait := c.cfg.dataPoll
+		if dl := c.writeDeadline.Load(); dl != nil && !dl.IsZero() {
+			remaining := time.Until(*dl)
+			if remaining <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			wait = min(wait, remaining)
+		}
+
+		err := c.fetch()
+		if err == nil {
+			c.wakeReader()
+			continue
+		}
+		if !errors.Is(err, ErrNoData) {
+			if errors.Is(err, context.Canceled) && c.closed.Load() == 1 {
+				return net.ErrClosed
+			}
+			return err
+		}
+		if c.peerExpired() {
+			c.markPeerIdle()
+			return ErrPeerTimeout
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-c.ctx.Done():
+		case <-c.flow.raised:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+	return nil
+}
+
+// wakeReader tells an idle Read that data was fetched on its behalf.
+func (c *Conn) wakeReader() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,136 @@
+package aznet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSetupFlow(t *testing.T) {
+	tests := []struct {
+		name        string
+		ours, peer  int64
+		wantLimited bool
+		wantWindow  int64 // receive window in force
+		wantLimit   int64
+		wantPending bool // waiting for the peer's first Window frame
+	}{
+		{"no window", 0, 100, false, 0, 0, false},
+		{"peer unknown", 100, 0, false, 0, 0, true},
+		{"both windows", 100, 50, true, 100, 50, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Conn{}
+			c.setupFlow(tt.ours, tt.peer)
+			if got := c.flow.limited.Load(); got != tt.wantLimited {
+				t.Errorf("limited = %v, want %v", got, tt.wantLimited)
+			}
+			if got := c.flow.window.Load(); got != tt.wantWindow {
+				t.Errorf("window = %d, want %d", got, tt.wantWindow)
+			}
+			if got := c.flow.limit.Load(); got != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", got, tt.wantLimit)
+			}
+			if got := c.flow.raised != nil; got != tt.wantPending {
+				t.Errorf("accepts Window frames = %v, want %v", got, tt.wantPending)
+			}
+			if tt.wantLimited && c.flow.advertised.Load() != tt.ours {
+				t.Errorf("advertised = %d, want %d", c.flow.advertised.Load(), tt.ours)
+			}
+		})
+	}
+}
+
+func TestAllowance(t *testing.T) {
+	tests := []struct {
+		name       string
+		ours, peer int64
+		sent       int64
+		want       int
+	}{
+		{"unlimited", 100, 0, 1 << 40, math.MaxInt},
+		{"within window", 100, 100, 30, 70},
+		{"window used up", 100, 100, 100, 0},
+		{"overshot before the limit applied", 100, 100, 120, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Conn{}
+			c.setupFlow(tt.ours, tt.peer)
+			c.flow.sent = tt.sent
+			if got := c.flow.allowance(); got != tt.want {
+				t.Errorf("allowance() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaiseLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		ours, peer  int64
+		updates     []int64
+		wantLimited bool
+		wantLimit   int64
+		wantRaised  bool
+	}{
+		{"no window ignores updates", 0, 0, []int64{100}, false, 0, false},
+		{"first frame enables", 100, 0, []int64{50}, true, 50, false},
+		{"grows", 100, 50, []int64{80}, true, 80, true},
+		{"stale update ignored", 100, 50, []int64{80, 60}, true, 80, true},
+		{"equal update is no raise", 100, 50, []int64{50}, true, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Conn{}
+			c.setupFlow(tt.ours, tt.peer)
+			for _, u := range tt.updates {
+				c.flow.raiseLimit(u)
+			}
+			if got := c.flow.limited.Load(); got != tt.wantLimited {
+				t.Errorf("limited = %v, want %v", got, tt.wantLimited)
+			}
+			if got := c.flow.limit.Load(); got != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", got, tt.wantLimit)
+			}
+			raised := false
+			if c.flow.raised != nil {
+				select {
+				case <-c.flow.raised:
+					raised = true
+				default:
+				}
+			}
+			if raised != tt.wantRaised {
+				t.Errorf("raised signalled = %v, want %v", raised, tt.wantRaised)
+			}
+		})
+	}
+}
+
+func TestConsume(t *testing.T) {
+	tests := []struct {
+		name       string
+		ours, peer int64
+		reads      []int
+		want       []int64 // advertised limit after each read
+	}{
+		{"off", 0, 100, []int{60}, []int64{0}},
+		{"not yet enabled", 100, 0, []int{60}, []int64{0}},
+		{"update at half a window", 100, 100, []int{30, 20, 49, 1}, []int64{100, 150, 150, 200}},
+		{"one large read", 100, 100, []int{250}, []int64{350}},
+		{"empty read", 100, 100, []int{0}, []int64{100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Conn{} // no buffers, so the Window frame itself is dropped
+			c.setupFlow(tt.ours, tt.peer)
+			for i, n := range tt.reads {
+				c.consume(n)
+				if got := c.flow.advertised.Load(); got != tt.want[i] {
+					t.Errorf("after read %d: advertised = %d, want %d", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package aznet
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// handshakeHello is the payload of the client's first handshake message. Under
+// the NN pattern message 1 is sent before any key is agreed, so the hello is
+// readable by anyone with access to the handshake endpoint. Unless a feature
+// needs more, it is the bare connection ID, which listeners of any version
+// parse; anything more is JSON.
+type handshakeHello struct {
+	ID    string            `json:"id"`
+	Trace map[string]string `json:"tc,omitempty"`   // W3C trace context of the dial
+	Suite CipherSuite       `json:"cs,omitempty"`   // non-default cipher suite
+	KEM   []byte            `json:"kem,omitempty"`  // ML-KEM-768 encapsulation key
+	Time  int64             `json:"ts,omitempty"`   // Unix time of the dial, for freshness
+	Data  []byte            `json:"data,omitempty"` // application data for the AcceptFilter
+}
+
+// bare reports whether the hello carries nothing but the connection ID.
+func (h handshakeHello) bare() bool {
+	return len(h.Trace) == 0 && h.Suite == "" && len(h.KEM) == 0 && h.Time == 0 && len(h.Data) == 0
+}
+
+func (h handshakeHello) marshal() ([]byte, error) {
+	if h.bare() {
+		return []byte(h.ID), nil
+	}
+	return json.Marshal(h)
+}
+
+// stamp returns when the hello was sent, or the zero time if the dialer did
+// not say.
+func (h handshakeHello) stamp() time.Time {
+	if h.Time == 0 {
+		return time.Time{}
+	}
+	return time.Unix(h.Time, 0)
+}
+
+// parseHandshakeHello decodes a hello in either form.
+func parseHandshakeHello(payload []byte) (handshakeHello, error) {
+	var h handshakeHello
+	if len(payload) > 0 && payload[0] == '{' {
+		if err := json.Unmarshal(payload, &h); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+		}
+	} else {
+		h.ID = string(payload)
+	}
+	if h.ID == "" {
+		return h, fmt.Errorf("%w: missing connection ID", ErrHandshakeFailed)
+	}
+	return h, nil
+}
+
+// tokenPayload is the payload of the listener's reply, carried encrypted in
+// Noise message 2. Older listeners send the bare SessionTokens. With the hybrid
+// key exchange the token holds the ML-KEM ciphertext, then message 2.
+type tokenPayload struct {
+	SessionTokens
+	Window int64 `json:"win,omitempty"` // listener's receive window
+}
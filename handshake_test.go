@@ -0,0 +1,55 @@
+package aznet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeHello(t *testing.T) {
+	tests := []struct {
+		name     string
+		hello    handshakeHello
+		wantBare bool // marshals to the bare connection ID older listeners expect
+	}{
+		{"bare ID", handshakeHello{ID: "abc"}, true},
+		{"trace context", handshakeHello{ID: "abc", Trace: map[string]string{"traceparent": "00-x-y-01"}}, false},
+		{"timestamp", handshakeHello{ID: "abc", Time: 1700000000}, false},
+		{"handshake data", handshakeHello{ID: "abc", Data: []byte("credential")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.hello.marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bare := string(b) == tt.hello.ID; bare != tt.wantBare {
+				t.Errorf("marshal() = %q, bare form %v, want %v", b, bare, tt.wantBare)
+			}
+			got, err := parseHandshakeHello(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.hello) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.hello)
+			}
+		})
+	}
+}
+
+func TestHandshakeHelloStamp(t *testing.T) {
+	if ts := (handshakeHello{ID: "abc"}).stamp(); !ts.IsZero() {
+		t.Errorf("stamp() of an unstamped hello = %v, want zero", ts)
+	}
+	if ts := (handshakeHello{ID: "abc", Time: 1700000000}).stamp(); ts.Unix() != 1700000000 {
+		t.Errorf("stamp() = %v, want Unix 1700000000", ts)
+	}
+}
+
+func TestParseHandshakeHelloInvalid(t *testing.T) {
+	for _, payload := range []string{"", "{}", `{"id":""}`, "{not json"} {
+		if _, err := parseHandshakeHello([]byte(payload)); !errors.Is(err, ErrHandshakeFailed) {
+			t.Errorf("parseHandshakeHello(%q) error = %v, want ErrHandshakeFailed", payload, err)
+		}
+	}
+}
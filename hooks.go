@@ -0,0 +1,41 @@
+package aznet
+
+// Hooks are callbacks for connection lifecycle events, set with WithHooks. Any
+// of them may be nil. They run synchronously on the goroutine that observed the
+// event, often with a storage call pending behind them, so they should return
+// quickly and must not call back into the connection.
+type Hooks struct {
+	// OnHandshake is called when the listener has claimed a client's handshake,
+	// after the accept filter and rate limit admitted it. A handshake whose
+	// session setup then fails is handed back, so it can fire again for the
+	// same connID.
+	OnHandshake func(connID string)
+	// OnAccept is called once the listener has set up the session for a
+	// connection, just before Accept returns it.
+	OnAccept func(c *Conn)
+	// OnRotate is called after a connection switches to a fresh channel, for
+	// its sending side when send is true and its receiving side otherwise.
+	OnRotate func(connID string, send bool)
+	// OnPeerIdle is called once when a connection's peer has been silent for
+	// longer than the idle timeout.
+	OnPeerIdle func(connID string)
+	// OnClose is called once when a connection is closed.
+	OnClose func(connID string, reason CloseReason)
+	// OnJanitorReap is called when the listener's janitor removes a
+	// connection and its storage.
+	OnJanitorReap func(connID string, reason CloseReason)
+}
+
+// CloseReason tells why a connection was closed or reaped.
+type CloseReason string
+
+const (
+	// CloseLocal means the application called Close on the connection.
+	CloseLocal CloseReason = "local"
+	// CloseListener means the connection was closed by Listener.Close.
+	CloseListener CloseReason = "listener closed"
+	// ClosePeerIdle means the listener gave up on a silent peer.
+	ClosePeerIdle CloseReason = "peer idle"
+	// CloseEvicted means the connection was closed by Listener.CloseConn.
+	CloseEvicted CloseReason = "evicted"
+)
@@ -2,8 +2,10 @@ package aznet
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync/atomic"
+	"time"
 )
 
 // Metrics is an interface for tracking connection statistics.
@@ -24,6 +26,37 @@ type Metrics interface {
 	GetBytesReceived() int64
 }
 
+// RTTRecorder is optionally implemented by Metrics that track round-trip times.
+// Connections report every ping/pong sample to it.
+type RTTRecorder interface {
+	RecordRTT(d time.Duration)
+}
+
+// ScopedMetrics is optionally implemented by Metrics that keep separate series
+// per connection. Each new transport counts its traffic into Scope(connID)
+// rather than into the shared Metrics, and calls Release(connID) once the
+// transport is closed; handshake and bootstrap operations stay on the shared
+// one.
+type ScopedMetrics interface {
+	Scope(connID string) Metrics
+	Release(connID string)
+}
+
+// RawIORecorder is optionally implemented by Metrics that track per-operation
+// latency and chunk sizes. size is the number of bytes in the chunk; it is 0
+// for an empty poll.
+type RawIORecorder interface {
+	RecordWriteRaw(d time.Duration, size int64)
+	RecordReadRaw(d time.Duration, size int64)
+}
+
+// QuarantineRecorder is optionally implemented by Metrics that count
+// handshakes a listener deleted without answering: malformed, expired, stale,
+// replayed or rejected ones, and duplicates of accepted connections.
+type QuarantineRecorder interface {
+	IncrementQuarantinedHandshakes()
+}
+
 // DefaultMetrics implements the Metrics interface with atomic counters.
 type DefaultMetrics struct {
 	writeTransactions  int64
@@ -32,6 +65,11 @@ type DefaultMetrics struct {
 	deleteTransactions int64
 	bytesSent          int64
 	bytesReceived      int64
+	quarantined        int64
+
+	rttLast     int64
+	rttMin      int64
+	rttSmoothed int64
 }
 
 // NewDefaultMetrics creates a new DefaultMetrics instance.
@@ -59,6 +97,46 @@ func (m *DefaultMetrics) GetDeleteTransactionCount() int64 {
 func (m *DefaultMetrics) GetBytesSent() int64     { return atomic.LoadInt64(&m.bytesSent) }
 func (m *DefaultMetrics) GetBytesReceived() int64 { return atomic.LoadInt64(&m.bytesReceived) }
 
+func (m *DefaultMetrics) IncrementQuarantinedHandshakes() { atomic.AddInt64(&m.quarantined, 1) }
+func (m *DefaultMetrics) GetQuarantinedHandshakeCount() int64 {
+	return atomic.LoadInt64(&m.quarantined)
+}
+
+// RecordRTT folds a round-trip sample from any connection into the last, min
+// and smoothed RTT.
+func (m *DefaultMetrics) RecordRTT(d time.Duration) {
+	atomic.StoreInt64(&m.rttLast, int64(d))
+	for {
+		cur := atomic.LoadInt64(&m.rttMin)
+		if cur != 0 && cur <= int64(d) {
+			break
+		}
+		if atomic.CompareAndSwapInt64(&m.rttMin, cur, int64(d)) {
+			break
+		}
+	}
+	for {
+		cur := atomic.LoadInt64(&m.rttSmoothed)
+		next := int64(d)
+		if cur != 0 {
+			next = cur + (int64(d)-cur)/8
+		}
+		if atomic.CompareAndSwapInt64(&m.rttSmoothed, cur, next) {
+			break
+		}
+	}
+}
+
+func (m *DefaultMetrics) GetLastRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.rttLast))
+}
+func (m *DefaultMetrics) GetMinRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.rttMin))
+}
+func (m *DefaultMetrics) GetSmoothedRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.rttSmoothed))
+}
+
 // GetMetrics returns the metrics from a connection if it supports metrics tracking.
 // It returns nil if the connection doesn't support metrics.
 func GetMetrics(c net.Conn) Metrics {
@@ -71,7 +149,28 @@ func GetMetrics(c net.Conn) Metrics {
 
 type metricsDriver struct {
 	Driver
-	m Metrics
+	claimer   HandshakeClaimer         // nil if underlying driver doesn't support claims
+	canceller HandshakeCanceller       // nil if underlying driver can't withdraw handshakes
+	hsCleaner HandshakeEndpointCleaner // nil if underlying driver removes both bootstrap endpoints at once
+	sweeper   SessionSweeper           // nil if underlying driver can't discover sessions
+	m         Metrics
+}
+
+func newMetricsDriver(d Driver, m Metrics) *metricsDriver {
+	md := &metricsDriver{Driver: d, m: m}
+	if c, ok := d.(HandshakeClaimer); ok {
+		md.claimer = c
+	}
+	if c, ok := d.(HandshakeCanceller); ok {
+		md.canceller = c
+	}
+	if hc, ok := d.(HandshakeEndpointCleaner); ok {
+		md.hsCleaner = hc
+	}
+	if sw, ok := d.(SessionSweeper); ok {
+		md.sweeper = sw
+	}
+	return md
 }
 
 func (d *metricsDriver) PostHandshake(ctx context.Context, connID string, data []byte) error {
@@ -100,6 +199,39 @@ func (d *metricsDriver) DeleteHandshake(ctx context.Context, id string) error {
 	return err
 }
 
+func (d *metricsDriver) ClaimHandshake(ctx context.Context, hs Handshake) (string, error) {
+	if d.claimer == nil {
+		return hs.ID, nil
+	}
+	id, err := d.claimer.ClaimHandshake(ctx, hs)
+	if err == nil {
+		d.m.IncrementWriteTransaction()
+	}
+	return id, err
+}
+
+func (d *metricsDriver) ReleaseHandshake(ctx context.Context, hs Handshake) error {
+	if d.claimer == nil {
+		return nil
+	}
+	err := d.claimer.ReleaseHandshake(ctx, hs)
+	if err == nil {
+		d.m.IncrementWriteTransaction()
+	}
+	return err
+}
+
+func (d *metricsDriver) CancelHandshake(ctx context.Context, connID string) error {
+	if d.canceller == nil {
+		return errors.ErrUnsupported
+	}
+	err := d.canceller.CancelHandshake(ctx, connID)
+	if err == nil {
+		d.m.IncrementWriteTransaction()
+	}
+	return err
+}
+
 func (d *metricsDriver) PostToken(ctx context.Context, connID string, data []byte) error {
 	err := d.Driver.PostToken(ctx, connID, data)
 	if err == nil {
@@ -114,6 +246,8 @@ func (d *metricsDriver) GetToken(ctx context.Context, connID string) ([]byte, er
 	if err == nil {
 		d.m.IncrementReadTransaction()
 		d.m.IncrementBytesReceived(int64(len(data)))
+	} else if errors.Is(err, ErrNoData) {
+		d.m.IncrementReadTransaction() // billed even though the token isn't there yet
 	}
 	return data, err
 }
@@ -135,11 +269,24 @@ func (d *metricsDriver) CreateSession(ctx context.Context, connID string) (Sessi
 }
 
 func (d *metricsDriver) NewTransport(ctx context.Context, connID string, tokens SessionTokens, isInitiator bool) (Transport, error) {
+	t, err := d.newTransport(ctx, connID, tokens, isInitiator)
+	if err != nil {
+		return nil, err // not a typed nil
+	}
+	return t, nil
+}
+
+func (d *metricsDriver) newTransport(ctx context.Context, connID string, tokens SessionTokens, isInitiator bool) (*metricsTransport, error) {
 	t, err := d.Driver.NewTransport(ctx, connID, tokens, isInitiator)
 	if err != nil {
 		return nil, err
 	}
-	return newMetricsTransport(t, d.m), nil
+	mt := newMetricsTransport(t, d.m)
+	if sm, ok := d.m.(ScopedMetrics); ok {
+		mt = newMetricsTransport(t, sm.Scope(connID))
+		mt.release = func() { sm.Release(connID) }
+	}
+	return mt, nil
 }
 
 func (d *metricsDriver) CleanupBootstrap(ctx context.Context) error {
@@ -151,6 +298,17 @@ func (d *metricsDriver) CleanupBootstrap(ctx context.Context) error {
 	return err
 }
 
+func (d *metricsDriver) CleanupHandshakeEndpoint(ctx context.Context) error {
+	if d.hsCleaner == nil {
+		return nil
+	}
+	err := d.hsCleaner.CleanupHandshakeEndpoint(ctx)
+	if err == nil {
+		d.m.IncrementDeleteTransaction()
+	}
+	return err
+}
+
 func (d *metricsDriver) CleanupSession(ctx context.Context, connID string) error {
 	err := d.Driver.CleanupSession(ctx, connID)
 	if err == nil {
@@ -158,3 +316,25 @@ func (d *metricsDriver) CleanupSession(ctx context.Context, connID string) error
 	}
 	return err
 }
+
+func (d *metricsDriver) TouchSession(ctx context.Context, connID string) error {
+	if d.sweeper == nil {
+		return nil
+	}
+	err := d.sweeper.TouchSession(ctx, connID)
+	if err == nil {
+		d.m.IncrementWriteTransaction()
+	}
+	return err
+}
+
+func (d *metricsDriver) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	if d.sweeper == nil {
+		return nil, nil
+	}
+	s, err := d.sweeper.ListSessions(ctx)
+	if err == nil {
+		d.m.IncrementListTransaction()
+	}
+	return s, err
+}
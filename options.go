@@ -2,7 +2,13 @@ package aznet
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"time"
+
+	"github.com/flynn/noise"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -34,6 +40,19 @@ const (
 	DefaultConnectTimeout = 30 * time.Second
 	// DefaultIdleTimeout is the idle timeout before considering a peer dead.
 	DefaultIdleTimeout = 5 * time.Minute
+
+	// DefaultReceiveWindow is how much unread data a connection lets its peer
+	// send ahead. Each half window read costs one write transaction for the
+	// window update.
+	DefaultReceiveWindow = 16 << 20
+
+	// DefaultHandshakeMaxAge is how far a handshake's timestamp may be from the
+	// listener's clock. It covers the default connect timeout plus clock skew.
+	DefaultHandshakeMaxAge = 2 * time.Minute
+
+	// DefaultHandshakeTTL is how long a handshake may sit in storage before a
+	// listener deletes it unanswered. Dialers give up long before.
+	DefaultHandshakeTTL = 10 * time.Minute
 )
 
 // Option defines a functional option for Listen/Dial.
@@ -62,6 +81,44 @@ type Config struct {
 
 	connectTimeout time.Duration
 	idleTimeout    time.Duration
+
+	maxConns     int
+	acceptRate   int
+	acceptWindow time.Duration
+	acceptFilter AcceptFilter
+
+	handshakeData []byte // dialer: passed to the listener's AcceptFilter
+
+	sweepInterval    time.Duration
+	cleanupEndpoints bool // listener: delete the bootstrap endpoints on Close and Shutdown
+
+	pollStrategy PollStrategyFunc
+
+	pricing    *Pricing // nil until set by WithPricing or from the driver default
+	costBudget *costBudget
+
+	tracer trace.Tracer // nil disables tracing
+	logger *slog.Logger
+	hooks  Hooks
+
+	retryPolicy RetryPolicy
+
+	receiveWindow int64
+
+	maxChunkSize  int // 0 uses the driver's MaxRawSize
+	minChunkSize  int
+	adaptiveChunk bool
+
+	cipherSuite CipherSuite       // empty until set by WithCipherSuite or the URL
+	noiseSuite  noise.CipherSuite // resolved from cipherSuite by initialize
+	hybridKEM   bool
+
+	handshakeMaxAge  time.Duration
+	handshakeTTL     time.Duration
+	strictHandshakes bool // listener: refuse hellos without a timestamp
+	stampHello       bool // dialer: send a timestamped JSON hello
+
+	service string
 }
 
 // Validate checks if the configuration is sane and valid.
@@ -72,6 +129,11 @@ func (c *Config) Validate() error {
 	if c.reqPrefix == c.resPrefix {
 		return ErrInvalidConfig
 	}
+	for _, param := range []string{cipherSuiteParam, kemParam, serviceParam} {
+		if c.handshakeEndpoint == param || c.tokenEndpoint == param {
+			return ErrInvalidConfig
+		}
+	}
 	return nil
 }
 
@@ -82,6 +144,11 @@ func defaultConfig() *Config {
 		ctx:               ctx,
 		cancel:            cancel,
 		metrics:           NewDefaultMetrics(),
+		logger:            slog.New(slog.DiscardHandler),
+		retryPolicy:       DefaultRetryPolicy,
+		receiveWindow:     DefaultReceiveWindow,
+		handshakeMaxAge:   DefaultHandshakeMaxAge,
+		handshakeTTL:      DefaultHandshakeTTL,
 		handshakeEndpoint: DefaultHandshakeEndpoint,
 		tokenEndpoint:     DefaultTokenEndpoint,
 		reqPrefix:         DefaultReqPrefix,
@@ -93,6 +160,7 @@ func defaultConfig() *Config {
 		pingInterval:      DefaultPingInterval,
 		connectTimeout:    DefaultConnectTimeout,
 		idleTimeout:       DefaultIdleTimeout,
+		pollStrategy:      DefaultPollStrategy,
 	}
 }
 
@@ -194,7 +262,8 @@ func WithConnectTimeout(d time.Duration) Option {
 }
 
 // WithIdleTimeout sets the grace period after which background janitors purge half-closed
-// connections that never completed a FIN handshake. Zero disables automatic cleanup.
+// connections that never completed a FIN handshake. With keep-alive enabled, a Conn whose
+// peer stays silent this long also fails reads and writes with ErrPeerTimeout.
 func WithIdleTimeout(d time.Duration) Option {
 	return func(c *Config) {
 		if d > 0 {
@@ -222,3 +291,343 @@ func WithMetrics(metrics Metrics) Option {
 		}
 	}
 }
+
+// WithMaxConns caps how many connections a listener keeps open at once. While at
+// the cap, Accept leaves pending handshakes untouched, so they remain available
+// to other listener instances or to this one once a connection is reaped. Zero
+// means no limit.
+func WithMaxConns(n int) Option {
+	return func(c *Config) {
+		if n >= 0 {
+			c.maxConns = n
+		}
+	}
+}
+
+// WithAcceptRate limits a listener to admitting n handshakes per window. Excess
+// handshakes stay pending until a later window. Only handshakes that become
+// connections count towards n. Zero disables the limit.
+func WithAcceptRate(n int, window time.Duration) Option {
+	return func(c *Config) {
+		if n >= 0 && window > 0 {
+			c.acceptRate = n
+			c.acceptWindow = window
+		}
+	}
+}
+
+// WithAcceptFilter installs a callback that vets each decrypted handshake before
+// the listener creates session resources for it.
+func WithAcceptFilter(f AcceptFilter) Option {
+	return func(c *Config) {
+		c.acceptFilter = f
+	}
+}
+
+// WithHandshakeData attaches data to the dialer's handshake for the listener's
+// AcceptFilter, e.g. an application credential. It travels in the first Noise
+// message, which under the NN pattern is not encrypted, so anyone able to read
+// the handshake endpoint can read it too.
+func WithHandshakeData(data []byte) Option {
+	return func(c *Config) {
+		c.handshakeData = data
+	}
+}
+
+// WithEndpointCleanup makes a listener delete the shared handshake and token
+// endpoints on Close and Shutdown. Leave it off when other listener replicas
+// share the endpoints, or they stop receiving dials.
+func WithEndpointCleanup() Option {
+	return func(c *Config) {
+		c.cleanupEndpoints = true
+	}
+}
+
+// WithSweepInterval makes a listener sweep orphaned sessions (per-connection
+// storage left by listeners that died without cleaning up) once at Listen and
+// then every d. Sessions untouched for longer than twice the idle timeout are
+// deleted. A sweeping listener also touches its own sessions every half idle
+// timeout, so listeners sharing an account should all enable sweeping. Zero,
+// the default, disables both; Listener.Sweep can still be called.
+func WithSweepInterval(d time.Duration) Option {
+	return func(c *Config) {
+		if d >= 0 {
+			c.sweepInterval = d
+		}
+	}
+}
+
+// WithPollStrategy replaces the back-off used between empty polls, for both
+// connections and the listener's accept loop. See NewBudgetPoll and
+// NewPredictivePoll for built-in alternatives to DefaultPollStrategy.
+func WithPollStrategy(f PollStrategyFunc) Option {
+	return func(c *Config) {
+		if f != nil {
+			c.pollStrategy = f
+		}
+	}
+}
+
+// WithPricing sets the prices used to turn metrics into an estimated cost, e.g.
+// for a region or access tier other than the DefaultPricing for the driver.
+func WithPricing(p Pricing) Option {
+	return func(c *Config) {
+		c.pricing = &p
+	}
+}
+
+// WithCostBudget caps the estimated spend of a listener or dialed connection at
+// amount per period, as computed from its metrics and pricing. Once the budget
+// for the current period is used up, the listener stops accepting new
+// connections and connections poll at a tenth of their usual steady rate, until
+// the next period starts.
+func WithCostBudget(amount float64, period time.Duration) Option {
+	return func(c *Config) {
+		if amount > 0 && period > 0 {
+			c.costBudget = &costBudget{amount: amount, period: period}
+		}
+	}
+}
+
+// overBudget reports whether the configured cost budget is exhausted.
+func (c *Config) overBudget() bool {
+	return c.costBudget.exceeded(c.metrics, *c.pricing)
+}
+
+// WithTracerProvider enables OpenTelemetry tracing. Dial and Accept get a span
+// each, with child spans for the storage calls that set up the session. Every
+// chunk upload, and every download that returns data, gets a root span linked
+// to the dial or accept span; empty polls are not traced. The dial's trace
+// context travels to the listener in the handshake payload, so both sides of a
+// connect appear in one trace. That payload is not encrypted (see the NN
+// pattern), so the trace and span IDs are visible to anyone who can read the
+// handshake endpoint.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Config) {
+		if tp != nil {
+			c.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+// WithLogger sets the logger for events the library otherwise handles silently:
+// rejected handshakes, session setup, key rotation, failed chunk writes that
+// will be retried, and connections reaped by the listener. Records carry a
+// conn_id attribute where one applies. By default nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) {
+		if l != nil {
+			c.logger = l
+		}
+	}
+}
+
+// WithHooks sets callbacks for connection lifecycle events, e.g. to keep an
+// inventory of sessions or an audit log. See Hooks.
+func WithHooks(h Hooks) Option {
+	return func(c *Config) {
+		c.hooks = h
+	}
+}
+
+// WithRetryPolicy sets how chunk reads and writes are retried after a transient
+// storage error such as throttling, before the error reaches Read or Write.
+// Pass RetryPolicy{} to disable retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Config) {
+		c.retryPolicy = p
+	}
+}
+
+// WithReceiveWindow sets how many bytes of data the peer may send ahead of what
+// the application has read; a Write on the other side blocks once that much is
+// outstanding. Flow control applies when both peers set a window, and drivers
+// may cap it (azqueue does, so bulk transfers fit its reassembly buffer). Zero
+// disables it.
+//
+// The listener sends its window with its handshake reply, and a dialer that
+// received one sends its own in a Window frame ahead of any data. Peers that
+// predate flow control do neither and get none.
+func WithReceiveWindow(n int64) Option {
+	return func(c *Config) {
+		if n >= 0 {
+			c.receiveWindow = n
+		}
+	}
+}
+
+// WithMaxChunkSize caps the size of each sealed chunk, i.e. each append block,
+// message or entity written, below the driver's own limit. Smaller chunks cut
+// latency for small writes but cost more transactions for bulk transfers. Values
+// below MinChunkSize are raised to it; zero keeps the driver's limit.
+func WithMaxChunkSize(n int) Option {
+	return func(c *Config) {
+		if n >= 0 {
+			c.maxChunkSize = n
+		}
+	}
+}
+
+// WithAdaptiveChunkSize lets each connection pick its chunk size between min and
+// the maximum chunk size: it starts at min, grows while writes arrive faster
+// than chunks are sent, and shrinks again for interactive traffic. A min of
+// zero uses DefaultMinChunkSize.
+func WithAdaptiveChunkSize(min int) Option {
+	return func(c *Config) {
+		if min <= 0 {
+			min = DefaultMinChunkSize
+		}
+		c.adaptiveChunk = true
+		c.minChunkSize = min
+	}
+}
+
+// WithCipherSuite sets the Noise cipher suite, e.g. CipherSuiteChaChaPolyBLAKE2s
+// for devices without AES acceleration. A listener advertises its suite in
+// ConnectionString, so dialers only need this option to override the URL.
+// Handshakes with a different suite are rejected.
+func WithCipherSuite(s CipherSuite) Option {
+	return func(c *Config) {
+		c.cipherSuite = s
+	}
+}
+
+// WithHandshakeMaxAge sets how far a handshake's timestamp may be from the
+// listener's clock, in either direction. Older handshakes are rejected and
+// deleted, as are handshakes of connections already accepted, so a replayed
+// handshake cannot make the listener create a session again. Handshakes without
+// a timestamp, from dialers that predate it or send a bare hello (see
+// WithHandshakeTimestamp), are accepted unless WithStrictHandshakes is set. Zero disables the check.
+func WithHandshakeMaxAge(d time.Duration) Option {
+	return func(c *Config) {
+		if d >= 0 {
+			c.handshakeMaxAge = d
+		}
+	}
+}
+
+// WithStrictHandshakes makes a listener reject and delete handshakes that carry
+// no timestamp, instead of accepting them without a freshness check. Only set
+// it once every dialer stamps its handshakes (see WithHandshakeTimestamp).
+func WithStrictHandshakes() Option {
+	return func(c *Config) {
+		c.strictHandshakes = true
+	}
+}
+
+// WithHandshakeTimestamp makes Dial stamp its hello with the time, so the
+// listener can check it is fresh (see WithHandshakeMaxAge). A stamp turns the
+// hello from the bare connection ID into JSON, which listeners that predate
+// handshake timestamps cannot parse. Hellos that are JSON anyway, e.g. for
+// tracing or WithHandshakeData, are always stamped.
+func WithHandshakeTimestamp() Option {
+	return func(c *Config) {
+		c.stampHello = true
+	}
+}
+
+// WithHandshakeTTL sets how long a handshake may sit in storage before a
+// listener deletes it unanswered, going by the time the driver reports it was
+// stored. Zero disables the expiry; malformed handshakes are deleted anyway.
+func WithHandshakeTTL(d time.Duration) Option {
+	return func(c *Config) {
+		if d >= 0 {
+			c.handshakeTTL = d
+		}
+	}
+}
+
+// WithHybridKeyExchange adds an ML-KEM-768 key exchange to the handshake, so
+// that recorded traffic stays confidential against an attacker who later
+// breaks X25519, e.g. with a quantum computer. It adds about 1.6 KiB to the
+// hello and 1 KiB to the listener's reply. A listener advertises it in
+// ConnectionString, so dialers pick it up from the URL; handshakes that
+// disagree are rejected.
+func WithHybridKeyExchange() Option {
+	return func(c *Config) {
+		c.hybridKEM = true
+	}
+}
+
+// WithService namespaces a listener's bootstrap endpoints and session
+// resources under a service name, a virtual port, so that several services can
+// share one storage account without seeing each other's handshakes or
+// sessions. A listener advertises its service in ConnectionString; a dialer
+// needs this option only to override the URL. Names are 1 to 16 lowercase
+// letters or digits, starting with a letter, so that the namespaced resource
+// names stay valid for every driver.
+func WithService(name string) Option {
+	return func(c *Config) {
+		c.service = name
+	}
+}
+
+const (
+	// cipherSuiteParam is the connection URL parameter carrying a non-default
+	// cipher suite.
+	cipherSuiteParam = "suite"
+	// serviceParam is the connection URL parameter carrying the service name.
+	serviceParam = "svc"
+)
+
+// maxServiceName bounds service names so that namespaced resource names stay
+// within the 63 characters containers, queues and tables allow.
+const maxServiceName = 16
+
+// applyURLParams fills in settings carried by the connection URL that no
+// option has set.
+func (c *Config) applyURLParams(q url.Values) {
+	if c.cipherSuite == "" {
+		c.cipherSuite = CipherSuite(q.Get(cipherSuiteParam))
+	}
+	if q.Get(kemParam) == kemMLKEM768 {
+		c.hybridKEM = true
+	}
+	if c.service == "" {
+		c.service = q.Get(serviceParam)
+	}
+}
+
+// validateService checks the service name against the rules of every driver.
+func (c *Config) validateService() error {
+	if c.service == "" {
+		return nil
+	}
+	if len(c.service) > maxServiceName || c.service[0] < 'a' || c.service[0] > 'z' {
+		return fmt.Errorf("%w: service name %q", ErrInvalidConfig, c.service)
+	}
+	for _, r := range c.service {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%w: service name %q", ErrInvalidConfig, c.service)
+		}
+	}
+	return nil
+}
+
+// applyService prefixes the bootstrap endpoints and channel prefixes with the
+// service name, joined by sep. It must run after applyURLParams, which may
+// supply the service.
+func (c *Config) applyService(sep string) {
+	if c.service == "" {
+		return
+	}
+	c.handshakeEndpoint = c.service + sep + c.handshakeEndpoint
+	c.tokenEndpoint = c.service + sep + c.tokenEndpoint
+	c.reqPrefix = c.service + sep + c.reqPrefix
+	c.resPrefix = c.service + sep + c.resPrefix
+}
+
+// urlParams returns the settings a listener puts in its connection URL.
+func (c *Config) urlParams() url.Values {
+	q := url.Values{}
+	if c.cipherSuite != "" && c.cipherSuite != CipherSuiteAESGCMSHA256 {
+		q.Set(cipherSuiteParam, string(c.cipherSuite))
+	}
+	if c.hybridKEM {
+		q.Set(kemParam, kemMLKEM768)
+	}
+	if c.service != "" {
+		q.Set(serviceParam, c.service)
+	}
+	return q
+}
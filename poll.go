@@ -5,6 +5,50 @@ import (
 	"time"
 )
 
+// PollStrategy decides how long a reader waits between polls that found
+// nothing. Each connection (and each listener's accept loop) gets its own
+// instance, which must be safe for concurrent use.
+type PollStrategy interface {
+	// Next returns the interval to wait before the next poll. The caller does
+	// the waiting.
+	Next() time.Duration
+	// Reset signals activity: data arrived, or a local send woke the reader
+	// because a reply is likely.
+	Reset()
+}
+
+// TrafficObserver is optionally implemented by a PollStrategy that learns from
+// the connection's traffic.
+type TrafficObserver interface {
+	// ObservePoll is called just before each read transaction, whether it
+	// follows a wait or not.
+	ObservePoll()
+	// ObserveSend is called after a chunk has been written to the peer.
+	ObserveSend()
+	// ObserveReceive is called when data has arrived from the peer.
+	ObserveReceive()
+	// ObserveRTT is called with each ping/pong round-trip sample.
+	ObserveRTT(d time.Duration)
+}
+
+// WakeGate is optionally implemented by a PollStrategy that must approve polls
+// ahead of the interval Next returned. Without it, a local send that makes a
+// reply likely always cuts the wait short.
+type WakeGate interface {
+	// AllowWake reports whether a poll may be made now.
+	AllowWake() bool
+}
+
+// PollStrategyFunc builds a PollStrategy from the configured fast and steady
+// intervals (fast poll and data poll for connections; the accept poll for both
+// in a listener).
+type PollStrategyFunc func(fast, steady time.Duration) PollStrategy
+
+// DefaultPollStrategy is the exponential back-off of AdaptivePoll.
+func DefaultPollStrategy(fast, steady time.Duration) PollStrategy {
+	return NewAdaptivePoll(fast, steady)
+}
+
 // AdaptivePoll implements an exponential back-off sleep utility.
 // Call Reset() after any activity to return to the fast interval.
 // Safe for concurrent use.
@@ -56,3 +100,165 @@ func (p *AdaptivePoll) Reset() {
 	p.Cur = p.Fast
 	p.skip = true
 }
+
+// Current returns the interval the next empty poll will wait.
+func (p *AdaptivePoll) Current() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Cur
+}
+
+// BudgetPoll caps read transactions per hour on top of AdaptivePoll's back-off.
+// Polls are spaced so their long-run rate stays within budget, with up to a
+// minute's worth of budget available as a burst after a quiet period. Every
+// read is charged once as it is made, whether it returns data or not and
+// whether it follows a wait, a local send or another read.
+type BudgetPoll struct {
+	inner    *AdaptivePoll
+	mu       sync.Mutex
+	interval time.Duration // average spacing the budget allows
+	burst    time.Duration // how far ahead of schedule polls may run
+	tat      time.Time     // theoretical arrival time of the next in-budget read
+}
+
+// NewBudgetPoll returns a PollStrategyFunc whose pollers each stay within
+// maxReadsPerHour read transactions.
+func NewBudgetPoll(maxReadsPerHour int) PollStrategyFunc {
+	return func(fast, steady time.Duration) PollStrategy {
+		interval := time.Hour / time.Duration(max(maxReadsPerHour, 1))
+		return &BudgetPoll{
+			inner:    NewAdaptivePoll(fast, steady),
+			interval: interval,
+			burst:    max(time.Minute, interval),
+		}
+	}
+}
+
+// Next returns the back-off interval, stretched when polling that soon would
+// exceed the budget.
+func (p *BudgetPoll) Next() time.Duration {
+	d := p.inner.Next()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return max(d, time.Until(p.earliest()))
+}
+
+// AllowWake approves an early poll while the budget has room for it.
+func (p *BudgetPoll) AllowWake() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !time.Now().Before(p.earliest())
+}
+
+// Reset returns the inner back-off to the fast interval.
+func (p *BudgetPoll) Reset() { p.inner.Reset() }
+
+// Current returns the inner back-off interval, before any budget stretch.
+func (p *BudgetPoll) Current() time.Duration { return p.inner.Current() }
+
+// ObservePoll charges a read against the budget.
+func (p *BudgetPoll) ObservePoll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now := time.Now(); p.tat.Before(now) {
+		p.tat = now
+	}
+	p.tat = p.tat.Add(p.interval)
+}
+
+func (p *BudgetPoll) ObserveSend()             {}
+func (p *BudgetPoll) ObserveReceive()          {}
+func (p *BudgetPoll) ObserveRTT(time.Duration) {}
+
+// earliest returns when the next read fits in the budget. Caller must hold
+// p.mu.
+func (p *BudgetPoll) earliest() time.Time {
+	return p.tat.Add(-p.burst)
+}
+
+// PredictivePoll learns how long the peer takes to answer after we send, and
+// instead of fast-polling right after a send it sleeps until a reply is
+// predicted, then polls fast around that moment. Request/response workloads
+// with a slow peer save most of the polls AdaptivePoll would spend waiting.
+// With no send outstanding, or once a prediction goes stale, it falls back to
+// AdaptivePoll.
+type PredictivePoll struct {
+	inner *AdaptivePoll
+	mu    sync.Mutex
+
+	lastSend time.Time
+	awaiting bool          // a send is outstanding with no data back yet
+	reply    time.Duration // smoothed send-to-reply latency, gain 1/4
+}
+
+// NewPredictivePoll builds a PredictivePoll. Its signature matches
+// PollStrategyFunc.
+func NewPredictivePoll(fast, steady time.Duration) PollStrategy {
+	return &PredictivePoll{inner: NewAdaptivePoll(fast, steady)}
+}
+
+// Next waits out the predicted reply latency after a send, capped at the steady
+// interval, then polls at the fast interval until the reply is as late again
+// as predicted.
+func (p *PredictivePoll) Next() time.Duration {
+	p.mu.Lock()
+	awaiting, reply, lastSend := p.awaiting, p.reply, p.lastSend
+	p.mu.Unlock()
+
+	if awaiting && reply > 0 {
+		until := time.Until(lastSend.Add(reply))
+		switch {
+		case until > p.inner.Fast:
+			return min(until, p.inner.Steady)
+		case -until < reply:
+			return p.inner.Fast
+		}
+	}
+	return p.inner.Next()
+}
+
+// Reset returns the fallback back-off to the fast interval.
+func (p *PredictivePoll) Reset() { p.inner.Reset() }
+
+// Current returns the fallback back-off interval.
+func (p *PredictivePoll) Current() time.Duration { return p.inner.Current() }
+
+func (p *PredictivePoll) ObservePoll() {}
+
+// ObserveSend starts timing the peer's reply.
+func (p *PredictivePoll) ObserveSend() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSend = time.Now()
+	p.awaiting = true
+}
+
+// ObserveReceive completes a reply sample if a send was outstanding.
+func (p *PredictivePoll) ObserveReceive() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.awaiting {
+		return
+	}
+	p.awaiting = false
+	p.fold(time.Since(p.lastSend))
+}
+
+// ObserveRTT seeds the prediction before the first reply is seen.
+func (p *PredictivePoll) ObserveRTT(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reply == 0 {
+		p.fold(d)
+	}
+}
+
+// fold adds one latency sample. Caller must hold p.mu.
+func (p *PredictivePoll) fold(d time.Duration) {
+	if p.reply == 0 {
+		p.reply = d
+		return
+	}
+	p.reply += (d - p.reply) / 4
+}
@@ -0,0 +1,76 @@
+package aznet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptivePoll(t *testing.T) {
+	const fast, steady = 10 * time.Millisecond, 50 * time.Millisecond
+	tests := []struct {
+		name string
+		ops  string // n = Next, r = Reset
+		want []time.Duration
+	}{
+		{"backs off to steady", "nnnnn", []time.Duration{10, 20, 40, 50, 50}},
+		{"reset polls at once, then fast", "nnnrnn", []time.Duration{10, 20, 40, 0, 10}},
+		{"repeated reset skips once", "nrrnn", []time.Duration{10, 0, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewAdaptivePoll(fast, steady)
+			var got []time.Duration
+			for _, op := range tt.ops {
+				switch op {
+				case 'n':
+					got = append(got, p.Next()/time.Millisecond)
+				case 'r':
+					p.Reset()
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetPoll(t *testing.T) {
+	const fast, steady = 10 * time.Millisecond, 50 * time.Millisecond
+	// 3600 reads an hour is one a second, with a minute's burst.
+	tests := []struct {
+		name      string
+		polls     int
+		receives  int
+		wantNext  time.Duration // lower bound
+		maxNext   time.Duration
+		wantAllow bool
+	}{
+		{"fresh budget", 0, 0, fast, fast, true},
+		{"within burst", 59, 0, fast, fast, true},
+		{"burst spent", 61, 0, 900 * time.Millisecond, time.Second, false},
+		{"receives are not charged twice", 59, 100, fast, fast, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewBudgetPoll(3600)(fast, steady).(*BudgetPoll)
+			for range tt.polls {
+				p.ObservePoll()
+			}
+			for range tt.receives {
+				p.ObserveReceive()
+			}
+			if got := p.AllowWake(); got != tt.wantAllow {
+				t.Errorf("AllowWake() = %v, want %v", got, tt.wantAllow)
+			}
+			if got := p.Next(); got < tt.wantNext || got > tt.maxNext {
+				t.Errorf("Next() = %v, want within [%v, %v]", got, tt.wantNext, tt.maxNext)
+			}
+		})
+	}
+}
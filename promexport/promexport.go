@@ -0,0 +1,286 @@
+// Package promexport exposes aznet metrics as Prometheus collectors.
+//
+// An Exporter implements aznet.Metrics and is passed to a listener or dialer
+// through aznet.WithMetrics, then registered with a Prometheus registry:
+//
+//	exp := promexport.New("azblob", "ingest")
+//	prometheus.MustRegister(exp)
+//	l, err := aznet.Listen("azblob", address, aznet.WithMetrics(exp))
+//
+// Series carry driver, listener and conn labels. Operations that don't belong to
+// a connection, such as handshakes, are reported with an empty conn label. A
+// connection's series are dropped when it closes; its counts live on in the
+// unlabelled totals so that counters never go backwards.
+package promexport
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atsika/aznet"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "aznet"
+
+var labels = []string{"driver", "listener", "conn"}
+
+var (
+	transactionsDesc = prometheus.NewDesc(
+		namespace+"_transactions_total",
+		"Storage transactions issued, by operation class.",
+		append(labels, "op"), nil)
+	bytesSentDesc = prometheus.NewDesc(
+		namespace+"_bytes_sent_total",
+		"Bytes written to storage.",
+		labels, nil)
+	bytesReceivedDesc = prometheus.NewDesc(
+		namespace+"_bytes_received_total",
+		"Bytes read from storage.",
+		labels, nil)
+	quarantinedDesc = prometheus.NewDesc(
+		namespace+"_handshakes_quarantined_total",
+		"Handshakes the listener deleted without answering.",
+		labels[:2], nil)
+	rttDesc = prometheus.NewDesc(
+		namespace+"_rtt_smoothed_seconds",
+		"Smoothed round-trip time measured with ping/pong frames.",
+		labels[:2], nil)
+)
+
+// Buckets used by the latency and chunk size histograms.
+var (
+	LatencyBuckets = prometheus.ExponentialBuckets(0.005, 2, 12) // 5ms to ~10s
+	SizeBuckets    = prometheus.ExponentialBuckets(1024, 4, 8)   // 1KiB to 16MiB
+)
+
+// Operation classes, in the order of counters.tx.
+var ops = [...]string{"write", "read", "list", "delete"}
+
+const (
+	opWrite = iota
+	opRead
+	opList
+	opDelete
+)
+
+type counters struct {
+	tx             [len(ops)]atomic.Int64
+	sent, received atomic.Int64
+}
+
+func (c *counters) add(o *counters) {
+	for i := range c.tx {
+		c.tx[i].Add(o.tx[i].Load())
+	}
+	c.sent.Add(o.sent.Load())
+	c.received.Add(o.received.Load())
+}
+
+func (c *counters) collect(ch chan<- prometheus.Metric, lv ...string) {
+	for i, op := range ops {
+		ch <- prometheus.MustNewConstMetric(transactionsDesc, prometheus.CounterValue,
+			float64(c.tx[i].Load()), append(lv, op)...)
+	}
+	ch <- prometheus.MustNewConstMetric(bytesSentDesc, prometheus.CounterValue, float64(c.sent.Load()), lv...)
+	ch <- prometheus.MustNewConstMetric(bytesReceivedDesc, prometheus.CounterValue, float64(c.received.Load()), lv...)
+}
+
+// Exporter implements aznet.Metrics, aznet.ScopedMetrics, aznet.RTTRecorder and
+// aznet.QuarantineRecorder, and is a prometheus.Collector. Create one per
+// listener or dialer with New.
+type Exporter struct {
+	driver   string
+	listener string
+
+	root   counters // operations outside any connection, and released ones
+	rtt    aznet.DefaultMetrics
+	mu     sync.Mutex
+	conns  map[string]*Scope
+	hasRTT atomic.Bool
+
+	quarantined atomic.Int64
+
+	writeLatency *prometheus.HistogramVec
+	readLatency  *prometheus.HistogramVec
+	chunkSize    *prometheus.HistogramVec
+}
+
+// New returns an Exporter labelling its series with the given driver and
+// listener names. listener only needs to tell apart exporters registered with
+// the same registry; use e.g. "client" for dialers.
+func New(driver, listener string) *Exporter {
+	constLabels := prometheus.Labels{"driver": driver, "listener": listener}
+	return &Exporter{
+		driver:   driver,
+		listener: listener,
+		conns:    make(map[string]*Scope),
+		writeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "write_raw_duration_seconds",
+			Help:        "Latency of chunk uploads.",
+			Buckets:     LatencyBuckets,
+			ConstLabels: constLabels,
+		}, []string{"conn"}),
+		readLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "read_raw_duration_seconds",
+			Help:        "Latency of chunk downloads, including empty polls.",
+			Buckets:     LatencyBuckets,
+			ConstLabels: constLabels,
+		}, []string{"conn"}),
+		chunkSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "chunk_size_bytes",
+			Help:        "Size of chunks moved through storage, by direction.",
+			Buckets:     SizeBuckets,
+			ConstLabels: constLabels,
+		}, []string{"conn", "direction"}),
+	}
+}
+
+// Scope returns the metrics of one connection. aznet calls it for every new
+// transport.
+func (e *Exporter) Scope(connID string) aznet.Metrics {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.conns[connID]
+	if !ok {
+		s = &Scope{e: e, connID: connID}
+		e.conns[connID] = s
+	}
+	return s
+}
+
+// Release drops the series of a closed connection and folds its counts into
+// the exporter's own. aznet calls it when the transport is closed.
+func (e *Exporter) Release(connID string) {
+	// Folding and deleting under one lock keeps total from seeing the counts
+	// in neither place, or in both.
+	e.mu.Lock()
+	s, ok := e.conns[connID]
+	if ok {
+		e.root.add(&s.c)
+		delete(e.conns, connID)
+	}
+	e.mu.Unlock()
+	if !ok {
+		return
+	}
+	e.writeLatency.DeleteLabelValues(connID)
+	e.readLatency.DeleteLabelValues(connID)
+	e.chunkSize.DeleteLabelValues(connID, "tx")
+	e.chunkSize.DeleteLabelValues(connID, "rx")
+}
+
+// total sums a counter over the exporter and all live connections.
+func (e *Exporter) total(get func(*counters) *atomic.Int64) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := get(&e.root).Load()
+	for _, s := range e.conns {
+		n += get(&s.c).Load()
+	}
+	return n
+}
+
+func tx(op int) func(*counters) *atomic.Int64 {
+	return func(c *counters) *atomic.Int64 { return &c.tx[op] }
+}
+
+func sent(c *counters) *atomic.Int64     { return &c.sent }
+func received(c *counters) *atomic.Int64 { return &c.received }
+
+func (e *Exporter) IncrementWriteTransaction()     { e.root.tx[opWrite].Add(1) }
+func (e *Exporter) IncrementReadTransaction()      { e.root.tx[opRead].Add(1) }
+func (e *Exporter) IncrementListTransaction()      { e.root.tx[opList].Add(1) }
+func (e *Exporter) IncrementDeleteTransaction()    { e.root.tx[opDelete].Add(1) }
+func (e *Exporter) IncrementBytesSent(n int64)     { e.root.sent.Add(n) }
+func (e *Exporter) IncrementBytesReceived(n int64) { e.root.received.Add(n) }
+
+// The getters report totals over all connections, as aznet expects of the
+// Metrics passed to WithMetrics (e.g. for WithCostBudget).
+func (e *Exporter) GetWriteTransactionCount() int64  { return e.total(tx(opWrite)) }
+func (e *Exporter) GetReadTransactionCount() int64   { return e.total(tx(opRead)) }
+func (e *Exporter) GetListTransactionCount() int64   { return e.total(tx(opList)) }
+func (e *Exporter) GetDeleteTransactionCount() int64 { return e.total(tx(opDelete)) }
+func (e *Exporter) GetBytesSent() int64              { return e.total(sent) }
+func (e *Exporter) GetBytesReceived() int64          { return e.total(received) }
+
+// RecordRTT folds a round-trip sample into the smoothed RTT gauge.
+func (e *Exporter) RecordRTT(d time.Duration) {
+	e.rtt.RecordRTT(d)
+	e.hasRTT.Store(true)
+}
+
+// IncrementQuarantinedHandshakes counts a handshake deleted unanswered.
+func (e *Exporter) IncrementQuarantinedHandshakes() { e.quarantined.Add(1) }
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- transactionsDesc
+	ch <- bytesSentDesc
+	ch <- bytesReceivedDesc
+	ch <- rttDesc
+	ch <- quarantinedDesc
+	e.writeLatency.Describe(ch)
+	e.readLatency.Describe(ch)
+	e.chunkSize.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.root.collect(ch, e.driver, e.listener, "")
+	e.mu.Lock()
+	for id, s := range e.conns {
+		s.c.collect(ch, e.driver, e.listener, id)
+	}
+	e.mu.Unlock()
+	if e.hasRTT.Load() {
+		ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue,
+			e.rtt.GetSmoothedRTT().Seconds(), e.driver, e.listener)
+	}
+	ch <- prometheus.MustNewConstMetric(quarantinedDesc, prometheus.CounterValue,
+		float64(e.quarantined.Load()), e.driver, e.listener)
+	e.writeLatency.Collect(ch)
+	e.readLatency.Collect(ch)
+	e.chunkSize.Collect(ch)
+}
+
+// Scope holds the metrics of one connection. It implements aznet.Metrics and
+// aznet.RawIORecorder.
+type Scope struct {
+	e      *Exporter
+	connID string
+	c      counters
+}
+
+func (s *Scope) IncrementWriteTransaction()     { s.c.tx[opWrite].Add(1) }
+func (s *Scope) IncrementReadTransaction()      { s.c.tx[opRead].Add(1) }
+func (s *Scope) IncrementListTransaction()      { s.c.tx[opList].Add(1) }
+func (s *Scope) IncrementDeleteTransaction()    { s.c.tx[opDelete].Add(1) }
+func (s *Scope) IncrementBytesSent(n int64)     { s.c.sent.Add(n) }
+func (s *Scope) IncrementBytesReceived(n int64) { s.c.received.Add(n) }
+
+func (s *Scope) GetWriteTransactionCount() int64  { return s.c.tx[opWrite].Load() }
+func (s *Scope) GetReadTransactionCount() int64   { return s.c.tx[opRead].Load() }
+func (s *Scope) GetListTransactionCount() int64   { return s.c.tx[opList].Load() }
+func (s *Scope) GetDeleteTransactionCount() int64 { return s.c.tx[opDelete].Load() }
+func (s *Scope) GetBytesSent() int64              { return s.c.sent.Load() }
+func (s *Scope) GetBytesReceived() int64          { return s.c.received.Load() }
+
+// RecordWriteRaw observes one chunk upload.
+func (s *Scope) RecordWriteRaw(d time.Duration, size int64) {
+	s.e.writeLatency.WithLabelValues(s.connID).Observe(d.Seconds())
+	s.e.chunkSize.WithLabelValues(s.connID, "tx").Observe(float64(size))
+}
+
+// RecordReadRaw observes one chunk download or empty poll. Empty polls count
+// towards latency only.
+func (s *Scope) RecordReadRaw(d time.Duration, size int64) {
+	s.e.readLatency.WithLabelValues(s.connID).Observe(d.Seconds())
+	if size > 0 {
+		s.e.chunkSize.WithLabelValues(s.connID, "rx").Observe(float64(size))
+	}
+}
@@ -0,0 +1,99 @@
+package aznet
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ConnState is the state of a connection as seen by its listener.
+type ConnState int
+
+const (
+	// ConnOpen means data can flow both ways.
+	ConnOpen ConnState = iota
+	// ConnHalfClosed means one side has sent FIN (see Conn.CloseWrite).
+	ConnHalfClosed
+	// ConnClosed means the connection is closed and awaits reaping.
+	ConnClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnOpen:
+		return "open"
+	case ConnHalfClosed:
+		return "half-closed"
+	case ConnClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// ConnInfo is a snapshot of one connection of a listener.
+type ConnInfo struct {
+	ID           string
+	RemoteAddr   net.Addr
+	Created      time.Time
+	Age          time.Duration // time since Created, as of the snapshot
+	PeerLastSeen time.Time
+	State        ConnState
+
+	// Traffic of this connection alone, counted as in Metrics.
+	BytesSent         int64
+	BytesReceived     int64
+	WriteTransactions int64
+	ReadTransactions  int64
+}
+
+// Info returns a snapshot of the connection.
+func (c *Conn) Info() ConnInfo {
+	now := time.Now()
+	info := ConnInfo{
+		ID:           c.id,
+		RemoteAddr:   c.RemoteAddr(),
+		Created:      c.created,
+		Age:          now.Sub(c.created),
+		PeerLastSeen: c.PeerLastSeen(),
+		State:        c.state(),
+	}
+	if m := c.stats; m != nil {
+		info.BytesSent = m.GetBytesSent()
+		info.BytesReceived = m.GetBytesReceived()
+		info.WriteTransactions = m.GetWriteTransactionCount()
+		info.ReadTransactions = m.GetReadTransactionCount()
+	}
+	return info
+}
+
+func (c *Conn) state() ConnState {
+	switch {
+	case c.closed.Load() == 1:
+		return ConnClosed
+	case c.closedRead.Load() == 1 || c.closedWrite.Load() == 1:
+		return ConnHalfClosed
+	}
+	return ConnOpen
+}
+
+// Conns returns a snapshot of the connections this listener has accepted and
+// not yet reaped, in no particular order.
+func (l *Listener) Conns() []ConnInfo {
+	var infos []ConnInfo
+	l.conns.Range(func(_, value any) bool {
+		infos = append(infos, value.(*Conn).Info())
+		return true
+	})
+	return infos
+}
+
+// CloseConn closes the connection with the given ID and deletes its storage
+// right away, without waiting for the janitor. The peer sees the FIN if it
+// polls before the storage is gone, and a read error otherwise. It returns
+// ErrConnNotFound if the listener has no such connection.
+func (l *Listener) CloseConn(id string) error {
+	if !l.reap(id, CloseEvicted) {
+		return fmt.Errorf("%w: %s", ErrConnNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package aznet
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// RetryPolicy controls how the core retries storage calls on the data path,
+// and a dialer's handshake post, that fail with a transient error, such as
+// throttling. Chunk writes are idempotent, so a retry never duplicates data.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first. Values
+	// below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the back-off before the first retry; it doubles with each
+	// further retry, up to MaxDelay if that is positive. The actual wait is
+	// jittered between half and all of it.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retryable classifies errors. Nil means IsRetryable.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries up to three times over roughly a second and a
+// half. It sits on top of the Azure SDK's own retries, which give up within a
+// few seconds of throttling; ServerBusy on a hot account often lasts longer.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// IsRetryable reports whether err is a storage error worth retrying: request
+// timeout (408), throttling (429, 503 ServerBusy) or an internal error (500).
+func IsRetryable(err error) bool {
+	var re *azcore.ResponseError
+	if !errors.As(err, &re) {
+		return false
+	}
+	switch re.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// backoff returns the jittered wait before retry n, counting from 0.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for ; n > 0 && d < math.MaxInt64/2; n-- {
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxDelay > 0 {
+		d = min(d, p.MaxDelay)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable reports whether err is worth retrying under p.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// retry runs op under the connection's retry policy. It gives up early, with
+// op's last error, once the connection is closed or the retry would not start
+// before the read or write deadline in deadline.
+func (c *Conn) retry(name string, deadline *atomic.Pointer[time.Time], op func() error) error {
+	return c.cfg.retry(c.ctx, c.id, name, func() time.Time {
+		if dl := deadline.Load(); dl != nil {
+			return *dl
+		}
+		return time.Time{}
+	}, op)
+}
+
+// retry runs op under the configured retry policy. It gives up early, with
+// op's last error, once ctx is done or the next try would start after the
+// time deadline returns; a nil deadline, or a zero time, means none.
+func (c *Config) retry(ctx context.Context, connID, name string, deadline func() time.Time, op func() error) error {
+	p := c.retryPolicy
+	err := op()
+	for n := 0; err != nil && n+1 < p.MaxAttempts && p.retryable(err); n++ {
+		d := p.backoff(n)
+		if deadline != nil {
+			if dl := deadline(); !dl.IsZero() && time.Now().Add(d).After(dl) {
+				return err
+			}
+		}
+		c.logger.Debug("aznet: retrying after transient error",
+			"conn_id", connID, "op", name, "attempt", n+2, "delay", d, "err", err)
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package aznet
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	const ms = time.Millisecond
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		n      int
+		want   time.Duration // the un-jittered delay; backoff returns [want/2, want]
+	}{
+		{"first retry", RetryPolicy{BaseDelay: 100 * ms, MaxDelay: time.Second}, 0, 100 * ms},
+		{"doubles", RetryPolicy{BaseDelay: 100 * ms, MaxDelay: time.Second}, 2, 400 * ms},
+		{"capped", RetryPolicy{BaseDelay: 100 * ms, MaxDelay: time.Second}, 5, time.Second},
+		{"no cap", RetryPolicy{BaseDelay: 100 * ms}, 5, 3200 * ms},
+		{"cap below base", RetryPolicy{BaseDelay: time.Second, MaxDelay: 100 * ms}, 0, 100 * ms},
+		{"no delay", RetryPolicy{}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				got := tt.policy.backoff(tt.n)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.n, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffOverflow(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Hour}
+	if got := p.backoff(100); got < time.Hour {
+		t.Errorf("backoff(100) = %v, want an uncapped delay that does not overflow", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&azcore.ResponseError{StatusCode: http.StatusRequestTimeout}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusInternalServerError}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusNotFound}, false},
+		{&azcore.ResponseError{StatusCode: http.StatusForbidden}, false},
+		{errors.New("plain"), false},
+		{ErrNoData, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConfigRetry(t *testing.T) {
+	busy := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	tests := []struct {
+		name      string
+		fails     int // calls that fail before op succeeds
+		err       error
+		deadline  time.Time
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds at once", 0, busy, time.Time{}, 1, false},
+		{"absorbs transient errors", 2, busy, time.Time{}, 3, false},
+		{"gives up after max attempts", 10, busy, time.Time{}, 4, true},
+		{"does not retry permanent errors", 10, errors.New("permanent"), time.Time{}, 1, true},
+		{"stops at the deadline", 10, busy, time.Now().Add(-time.Second), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{retryPolicy: policy, logger: slog.New(slog.DiscardHandler)}
+			calls := 0
+			err := cfg.retry(t.Context(), "conn", "op", func() time.Time { return tt.deadline }, func() error {
+				calls++
+				if calls <= tt.fails {
+					return tt.err
+				}
+				return nil
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("calls = %d, err = %v; want %d calls, error %v", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
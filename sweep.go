@@ -0,0 +1,121 @@
+package aznet
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionActivityKey is the metadata key under which drivers that support it
+// record when a session was last touched.
+const sessionActivityKey = "aznetlastactive"
+
+// activityMetadata returns session metadata stamped with t.
+func activityMetadata(t time.Time) map[string]*string {
+	v := t.UTC().Format(time.RFC3339)
+	return map[string]*string{sessionActivityKey: &v}
+}
+
+// parseActivity reads the activity stamp from session metadata. Keys are
+// matched case-insensitively, since the service does not preserve their case on
+// every API.
+func parseActivity(md map[string]*string) (time.Time, bool) {
+	for k, v := range md {
+		if v == nil || !strings.EqualFold(k, sessionActivityKey) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// sweepAgeFactor scales the idle timeout into the age at which Sweep presumes a
+// session orphaned. Live sessions are touched every half idle timeout, so a
+// session must miss several touches in a row before it is swept.
+const sweepAgeFactor = 2
+
+// Sweep deletes orphaned sessions: per-connection storage that no listener has
+// touched for longer than twice the idle timeout, typically left by a listener
+// process that crashed. Sessions owned by this listener are never swept. It
+// returns the number of sessions deleted.
+//
+// Only listeners with a sweep interval (see WithSweepInterval) touch their
+// sessions, so every listener sharing the account with a sweeping one must
+// have a sweep interval too.
+func (l *Listener) Sweep(ctx context.Context) (int, error) {
+	sw, ok := l.driver.(SessionSweeper)
+	if !ok {
+		return 0, nil
+	}
+	sessions, err := sw.ListSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, s := range sessions {
+		if _, ok := l.conns.Load(s.ConnID); ok {
+			continue
+		}
+		if time.Since(s.LastActive) <= sweepAgeFactor*l.cfg.idleTimeout {
+			continue
+		}
+		if err := l.driver.CleanupSession(ctx, s.ConnID); err != nil {
+			l.cfg.logger.Warn("aznet: sweeping orphaned session failed", "conn_id", s.ConnID, "err", err)
+			continue
+		}
+		l.cfg.logger.Info("aznet: swept orphaned session", "conn_id", s.ConnID, "last_active", s.LastActive)
+		swept++
+	}
+	return swept, nil
+}
+
+// sweeper runs Sweep at startup and then every sweepInterval.
+func (l *Listener) sweeper() {
+	ticker := time.NewTicker(l.cfg.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(l.cfg.ctx, l.cfg.sweepInterval)
+		if _, err := l.Sweep(ctx); err != nil {
+			l.cfg.logger.Warn("aznet: listing sessions failed", "err", err)
+		}
+		cancel()
+
+		select {
+		case <-l.cfg.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// touchConcurrency bounds how many sessions a listener touches at once.
+const touchConcurrency = 8
+
+// touch records that the sessions under ids are still in use, so sweepers in
+// other listener instances leave them alone. Each touch gets at most timeout,
+// the touch period, so a slow round cannot hold up the next.
+func (l *Listener) touch(ids []string, timeout time.Duration) {
+	sw, ok := l.driver.(SessionSweeper)
+	if !ok {
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, touchConcurrency)
+	for _, id := range ids {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			ctx, cancel := context.WithTimeout(l.cfg.ctx, timeout)
+			defer cancel()
+			if err := sw.TouchSession(ctx, id); err != nil {
+				l.cfg.logger.Debug("aznet: touching session failed", "conn_id", id, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
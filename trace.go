@@ -0,0 +1,114 @@
+package aznet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/atsika/aznet"
+
+// traceContext carries the dial's span context to the listener inside the
+// handshake hello, so both ends of a connect land in one trace.
+var traceContext propagation.TraceContext
+
+var attrConnID = attribute.Key("aznet.conn_id")
+
+// startSpan starts a span if tracing is enabled. Otherwise it returns ctx and
+// the no-op span found in it, so callers needn't check.
+func (c *Config) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return c.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingDriver adds spans around the session setup calls of a driver. It
+// wraps the metrics driver, whose optional interfaces it inherits.
+type tracingDriver struct {
+	*metricsDriver
+	cfg *Config
+}
+
+func (d *tracingDriver) PostHandshake(ctx context.Context, connID string, data []byte) (err error) {
+	ctx, span := d.cfg.startSpan(ctx, "aznet.PostHandshake", attrConnID.String(connID))
+	defer func() { endSpan(span, err) }()
+	return d.metricsDriver.PostHandshake(ctx, connID, data)
+}
+
+func (d *tracingDriver) CreateSession(ctx context.Context, connID string) (_ SessionTokens, err error) {
+	ctx, span := d.cfg.startSpan(ctx, "aznet.CreateSession", attrConnID.String(connID))
+	defer func() { endSpan(span, err) }()
+	return d.metricsDriver.CreateSession(ctx, connID)
+}
+
+func (d *tracingDriver) PostToken(ctx context.Context, connID string, data []byte) (err error) {
+	ctx, span := d.cfg.startSpan(ctx, "aznet.PostToken", attrConnID.String(connID))
+	defer func() { endSpan(span, err) }()
+	return d.metricsDriver.PostToken(ctx, connID, data)
+}
+
+func (d *tracingDriver) NewTransport(ctx context.Context, connID string, tokens SessionTokens, isInitiator bool) (_ Transport, err error) {
+	// The dial or accept span, which the connection's spans link back to.
+	setup := trace.LinkFromContext(ctx)
+	ctx, span := d.cfg.startSpan(ctx, "aznet.NewTransport",
+		attrConnID.String(connID), attribute.Bool("aznet.initiator", isInitiator))
+	defer func() { endSpan(span, err) }()
+	t, err := d.metricsDriver.newTransport(ctx, connID, tokens, isInitiator)
+	if err != nil {
+		return nil, err
+	}
+	return &tracingTransport{metricsTransport: t, cfg: d.cfg, connID: connID, setup: setup}, nil
+}
+
+// tracingTransport adds a span per chunk upload and per download that returned
+// data. Each is the root of a trace of its own, linked to the dial or accept
+// span: a connection can live for days, and parenting its calls to the setup
+// span would grow that trace without end. Empty polls get no span.
+type tracingTransport struct {
+	*metricsTransport
+	cfg    *Config
+	connID string
+	setup  trace.Link
+}
+
+// startRootSpan starts a data-path span at start, linked to the setup span.
+func (t *tracingTransport) startRootSpan(ctx context.Context, name string, start time.Time, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.cfg.tracer.Start(ctx, name, trace.WithNewRoot(), trace.WithLinks(t.setup),
+		trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+}
+
+func (t *tracingTransport) WriteRaw(ctx context.Context, seq uint64, data io.ReadSeeker) (err error) {
+	ctx, span := t.startRootSpan(ctx, "aznet.WriteRaw", time.Now(),
+		attrConnID.String(t.connID), attribute.Int64("aznet.seq", int64(seq)))
+	defer func() { endSpan(span, err) }()
+	return t.metricsTransport.WriteRaw(ctx, seq, data)
+}
+
+// ReadRaw only knows whether the poll was empty once it returns, so its span
+// is started after the fact, back-dated to the call.
+func (t *tracingTransport) ReadRaw(ctx context.Context) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := t.metricsTransport.ReadRaw(ctx)
+	if errors.Is(err, ErrNoData) {
+		return nil, err
+	}
+	_, span := t.startRootSpan(ctx, "aznet.ReadRaw", start, attrConnID.String(t.connID))
+	endSpan(span, err)
+	return rc, err
+}